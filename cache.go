@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/splitsh/lite/splitter"
+)
+
+const cacheUsage = `Usage: splitsh-lite cache <command> [--path=<repository>] [<key>]
+
+Commands:
+  list      list the cache buckets and the configuration they belong to
+  stats     show the number of mappings by bucket and the database size
+  show      show the details of a bucket
+  drop      remove a bucket
+  compact   rewrite the database to reclaim the unused space
+`
+
+// cacheCommand runs the cache subcommands and returns the exit code
+func cacheCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cacheUsage)
+		return 1
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("cache "+command, flag.ContinueOnError)
+	repository := flags.String("path", ".", "The repository path (optional, current directory by default)")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, cacheUsage)
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 1
+	}
+
+	var err error
+	switch command {
+	case "list":
+		err = cacheList(*repository)
+	case "stats":
+		err = cacheStats(*repository)
+	case "show":
+		if flags.NArg() != 1 {
+			err = fmt.Errorf("the bucket key is required")
+			break
+		}
+		err = cacheShow(*repository, flags.Arg(0))
+	case "drop":
+		if flags.NArg() != 1 {
+			err = fmt.Errorf("the bucket key is required")
+			break
+		}
+		err = splitter.DropBucket(*repository, flags.Arg(0))
+	case "compact":
+		var before, after int64
+		if before, after, err = splitter.CompactCache(*repository); err == nil {
+			fmt.Printf("compacted the cache from %d to %d bytes\n", before, after)
+		}
+	default:
+		fmt.Fprint(os.Stderr, cacheUsage)
+		return 1
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func cacheList(repository string) error {
+	buckets, err := splitter.ListBuckets(repository)
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range buckets {
+		fmt.Printf("%s %s\n", bucket.Key, describeBucket(bucket))
+	}
+
+	return nil
+}
+
+func cacheStats(repository string) error {
+	buckets, err := splitter.ListBuckets(repository)
+	if err != nil {
+		return err
+	}
+
+	mappings := 0
+	for _, bucket := range buckets {
+		mappings += bucket.Mappings
+		fmt.Printf("%s %d mappings, %d heads\n", bucket.Key, bucket.Mappings, len(bucket.Heads))
+	}
+
+	size := int64(0)
+	if info, err := os.Stat(filepath.Join(splitter.GitDirectory(repository), "splitsh.db")); err == nil {
+		size = info.Size()
+	}
+	fmt.Printf("%d buckets, %d mappings, %d bytes\n", len(buckets), mappings, size)
+
+	return nil
+}
+
+func cacheShow(repository, key string) error {
+	bucket, err := splitter.GetBucket(repository, key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("key: %s\n", bucket.Key)
+	if bucket.Meta != nil {
+		fmt.Printf("prefixes: %s\n", strings.Join(bucket.Meta.Prefixes, " "))
+		fmt.Printf("git: %s\n", bucket.Meta.Git)
+		if bucket.Meta.Commit != "" {
+			fmt.Printf("commit: %s\n", bucket.Meta.Commit)
+		}
+		fmt.Printf("updated: %s\n", bucket.Meta.Updated)
+	}
+	fmt.Printf("mappings: %d\n", bucket.Mappings)
+
+	var origins []string
+	for origin := range bucket.Heads {
+		origins = append(origins, origin)
+	}
+	sort.Strings(origins)
+	for _, origin := range origins {
+		fmt.Printf("head: %s %s\n", origin, bucket.Heads[origin])
+	}
+
+	return nil
+}
+
+// describeBucket describes the configuration of a bucket
+func describeBucket(bucket *splitter.Bucket) string {
+	if bucket.Meta == nil {
+		return "(unknown configuration)"
+	}
+
+	description := strings.Join(bucket.Meta.Prefixes, " ") + " (git " + bucket.Meta.Git
+	if bucket.Meta.Commit != "" {
+		description += ", from " + bucket.Meta.Commit
+	}
+	return description + ")"
+}
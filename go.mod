@@ -5,6 +5,7 @@ go 1.22
 require (
 	github.com/libgit2/git2go/v34 v34.0.0
 	go.etcd.io/bbolt v1.3.9
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	git "github.com/libgit2/git2go/v34"
+	"github.com/splitsh/lite/splitter"
+)
+
+// lookupCommand finds the mappings of a commit for the split described by the flags and returns the exit code
+func lookupCommand(args []string) int {
+	split := flag.String("split", "", "The split commit to find the original commit of")
+	original := flag.String("original", "", "The original commit to find the split commit of")
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 1
+	}
+
+	if (*split == "") == (*original == "") {
+		fmt.Fprintln(os.Stderr, "You must provide either the --split or the --original flag")
+		return 1
+	}
+
+	config, err := newConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	var splitOid, originalOid *git.Oid
+	if *split != "" {
+		splitOid, err = resolveCommit(*split)
+	} else {
+		originalOid, err = resolveCommit(*original)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	found := false
+	for _, c := range expand(config) {
+		name := expandedName("", config, c)
+		if name != "" {
+			name += " "
+		}
+
+		mappings, err := splitter.Lookup(c, originalOid, splitOid)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+
+		for _, mapping := range mappings {
+			fmt.Printf("%s%s %s\n", name, mapping.Original, mapping.Split)
+			found = true
+		}
+	}
+
+	if !found {
+		fmt.Fprintln(os.Stderr, "No mapping found")
+		return 1
+	}
+
+	return 0
+}
+
+// resolveCommit returns the sha1 of a (possibly abbreviated) commit
+func resolveCommit(value string) (*git.Oid, error) {
+	if oid, err := git.NewOid(value); err == nil {
+		return oid, nil
+	}
+
+	repo, err := git.OpenRepository(path)
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Free()
+
+	obj, err := repo.RevparseSingle(value)
+	if err != nil {
+		return nil, fmt.Errorf("unknown commit %s: %s", value, err)
+	}
+	defer obj.Free()
+
+	return obj.Id(), nil
+}
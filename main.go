@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/splitsh/lite/splitter"
@@ -14,6 +18,9 @@ var (
 	version = "dev"
 )
 
+// exitCanceled is the exit code when the split is interrupted (like shells for SIGINT)
+const exitCanceled = 130
+
 type prefixesFlag []*splitter.Prefix
 
 func (p *prefixesFlag) String() string {
@@ -25,36 +32,80 @@ func (p *prefixesFlag) Set(value string) error {
 	from := parts[0]
 	to := ""
 	excludes := make([]string, 0)
+	var includes []string
 	if len(parts) >= 2 {
 		to = strings.TrimRight(parts[1], "/")
 		if len(parts) > 2 {
 			for _, exclude := range parts[2:] {
+				// paths to keep are prefixed with a +
+				if strings.HasPrefix(exclude, "+") {
+					includes = append(includes, strings.TrimRight(exclude[1:], "/"))
+					continue
+				}
 				excludes = append(excludes, exclude)
 			}
 		}
 	}
 
-	// value must be unique
-	for _, prefix := range *p {
-		if prefix.To == to {
-			return fmt.Errorf("cannot have two prefix splits under the same directory: %s -> %s vs %s -> %s", prefix.From, prefix.To, from, to)
-		}
-	}
+	prefix := splitter.NewPrefix(from, to, excludes)
+	prefix.Includes = includes
+	*p = append(*p, prefix)
+	return nil
+}
+
+type stringsFlag []string
 
-	*p = append(*p, splitter.NewPrefix(from, to, excludes))
+func (s *stringsFlag) String() string {
+	return fmt.Sprint(*s)
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
 	return nil
 }
 
 var prefixes prefixesFlag
-var origin, target, commit, path, gitVersion string
-var scratch, debug, progress, v bool
+var markers, renames stringsFlag
+var origin, target, commit, path, gitVersion, manifestFile, push, tags, tagTarget, conflict, onto, message string
+var mailmapFile, committer, emptyEmail, signingKey, signProgram, signFormat, onRewrite string
+var mappingsFile, mappingsFormat, output string
+var scratch, debug, progress, pushForce, followRenames, rejoin, readJoins, mailmap, anonymize, v bool
+var checkpointCommits int
+var checkpointInterval time.Duration
 
 func init() {
 	flag.Var(&prefixes, "prefix", "The directory(ies) to split")
+	flag.Var(&markers, "marker", "Only split directories matching a prefix pattern when they contain this file (optional, can be repeated)")
+	flag.Var(&renames, "rename", "A former location of a prefix, as <prefix>:<former-path>[@<last-commit-sha1>] (optional, can be repeated)")
+	flag.BoolVar(&followRenames, "follow-renames", false, "Follow prefixes across renames by detecting identical directories (optional)")
 	flag.StringVar(&origin, "origin", "HEAD", "The branch to split (optional, defaults to the current one)")
 	flag.StringVar(&target, "target", "", "The branch to create when split is finished (optional)")
 	flag.StringVar(&commit, "commit", "", "The commit at which to start the split (optional)")
+	flag.StringVar(&tags, "tags", "", "Split the origin tags matching this pattern, like v* (optional)")
+	flag.StringVar(&tagTarget, "tag-target", "", "The reference template of split tags, like refs/tags/split/{tag} (required with --tags)")
+	flag.StringVar(&push, "push", "", "The remote (name or URL) and reference to push the split to, as <remote>:<ref> (optional)")
+	flag.BoolVar(&pushForce, "push-force", false, "Allow non fast-forward pushes (optional)")
+	flag.StringVar(&conflict, "conflict", "error", "What to do when prefixes produce the same paths: error, first, or last (optional)")
+	flag.BoolVar(&rejoin, "rejoin", false, "Merge the split back into the origin branch like git subtree split --rejoin (optional)")
+	flag.BoolVar(&readJoins, "read-joins", false, "Reuse the splits recorded by git subtree in commit trailers (optional)")
+	flag.StringVar(&onto, "onto", "", "The sha1 of an existing split history to continue (optional)")
+	flag.StringVar(&message, "message", "", "A template to rewrite commit messages, like {{ .Message | trailer \"Original-Commit\" .Original }} (optional)")
+	flag.BoolVar(&mailmap, "mailmap", false, "Apply the .mailmap file of the origin to authors and committers (optional)")
+	flag.StringVar(&mailmapFile, "mailmap-file", "", "Apply the given mailmap file to authors and committers (optional)")
+	flag.StringVar(&committer, "committer", "", "The committer of split commits, as \"Name <email>\" (optional, defaults to the original committers)")
+	flag.StringVar(&emptyEmail, "empty-email", "nobody@example.com", "The email used when the original one is empty (optional)")
+	flag.BoolVar(&anonymize, "anonymize", false, "Replace author and committer emails by a hash of them (optional)")
+	flag.StringVar(&signingKey, "signing-key", "", "Sign split commits and tags with this key, like Git user.signingKey (optional)")
+	flag.StringVar(&signProgram, "sign-program", "", "The program used to sign, like Git gpg.program (optional, gpg or ssh-keygen by default)")
+	flag.StringVar(&signFormat, "sign-format", "openpgp", "The signature format: openpgp or ssh (optional)")
 	flag.StringVar(&path, "path", ".", "The repository path (optional, current directory by default)")
+	flag.StringVar(&manifestFile, "config", "", "A manifest file (YAML or JSON) describing the splits to run (optional)")
+	flag.IntVar(&checkpointCommits, "checkpoint-commits", 10000, "Persist the cache every N split commits, to resume interrupted splits (optional, 0 to disable)")
+	flag.DurationVar(&checkpointInterval, "checkpoint-interval", 0, "Persist the cache at this interval, like 5m (optional)")
+	flag.StringVar(&onRewrite, "on-rewrite", "walk", "What to do when the origin history has been rewritten since the last split: walk or fail (optional)")
+	flag.StringVar(&mappingsFile, "mappings", "", "Write the mappings of the split commits to this file, - for the standard output (optional)")
+	flag.StringVar(&mappingsFormat, "mappings-format", "json", "The format of the mappings: json (one object per line) or csv (optional)")
+	flag.StringVar(&output, "output", "text", "The output format: text, or json for a single JSON document on stdout (optional)")
 	flag.BoolVar(&scratch, "scratch", false, "Flush the cache (optional)")
 	flag.BoolVar(&debug, "debug", false, "Enable the debug mode (optional)")
 	flag.StringVar(&gitVersion, "git", "latest", "Simulate a given version of Git (optional)")
@@ -63,6 +114,19 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "cache":
+			os.Exit(cacheCommand(os.Args[2:]))
+		case "verify":
+			os.Exit(verifyCommand(os.Args[2:]))
+		case "lookup":
+			os.Exit(lookupCommand(os.Args[2:]))
+		case "export":
+			os.Exit(exportCommand(os.Args[2:]))
+		}
+	}
+
 	flag.Parse()
 
 	if v {
@@ -70,20 +134,75 @@ func main() {
 		os.Exit(0)
 	}
 
-	if len(prefixes) == 0 {
-		fmt.Fprintln(os.Stderr, "You must provide the directory to split via the --prefix flag")
+	if output != "text" && output != "json" {
+		fmt.Fprintf(os.Stderr, "Unsupported output %s, must be text or json\n", output)
 		os.Exit(1)
 	}
 
-	config := &splitter.Config{
-		Path:       path,
-		Origin:     origin,
-		Prefixes:   prefixes,
-		Target:     target,
-		Commit:     commit,
-		Debug:      debug,
-		Scratch:    scratch,
-		GitVersion: gitVersion,
+	// the commits split so far are kept in the cache when interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// a second signal forces the exit
+		stop()
+	}()
+
+	if output == "json" && mappingsFile == "-" {
+		exitWithError(&splitter.ConfigError{Err: fmt.Errorf("the mappings cannot be written to stdout with the JSON output")}, nil)
+	}
+
+	mappings, err := openMappings(mappingsFile)
+	if err != nil {
+		exitWithError(&splitter.ConfigError{Err: err}, nil)
+	}
+
+	if manifestFile != "" {
+		if name := splitFlag(); name != "" {
+			exitWithError(&splitter.ConfigError{Err: fmt.Errorf("The --%s flag cannot be used with the --config flag", name)}, nil)
+		}
+
+		manifest, err := splitter.LoadManifest(manifestFile)
+		if err != nil {
+			exitWithError(&splitter.ConfigError{Err: err}, nil)
+		}
+
+		var names []string
+		var configs []*splitter.Config
+		for _, split := range manifest.Splits {
+			split.Config.Path = path
+			split.Config.Debug = debug
+			split.Config.Scratch = scratch
+			split.Config.CheckpointCommits = checkpointCommits
+			split.Config.CheckpointInterval = checkpointInterval
+			split.Config.OnRewrite = onRewrite
+			split.Config.Mappings = mappings
+
+			for _, config := range expand(split.Config) {
+				config.Name = expandedName(split.Name, split.Config, config)
+				names = append(names, config.Name)
+				configs = append(configs, config)
+			}
+		}
+
+		splitMany(ctx, names, configs)
+		os.Exit(0)
+	}
+
+	config, err := newConfig()
+	if err != nil {
+		exitWithError(&splitter.ConfigError{Err: err}, nil)
+	}
+	config.Mappings = mappings
+
+	if configs := expand(config); len(configs) > 1 || configs[0] != config {
+		names := make([]string, len(configs))
+		for i, c := range configs {
+			c.Name = expandedName("", config, c)
+			names[i] = c.Name
+		}
+		splitMany(ctx, names, configs)
+		os.Exit(0)
 	}
 
 	result := &splitter.Result{}
@@ -98,9 +217,8 @@ func main() {
 		}()
 	}
 
-	if err := splitter.Split(config, result); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+	if err := splitter.SplitContext(ctx, config, result); err != nil {
+		exitWithError(err, result)
 	}
 
 	if ticker != nil {
@@ -108,8 +226,204 @@ func main() {
 	}
 
 	fmt.Fprintf(os.Stderr, "%d commits created, %d commits traversed, in %s\n", result.Created(), result.Traversed(), result.Duration(time.Millisecond))
+	reportTags("", result)
+	reportRejoin("", result)
+	reportPush("", result)
+
+	if output == "json" {
+		printJSON(&jsonOutput{Result: result})
+		return
+	}
 
 	if result.Head() != nil {
 		fmt.Println(result.Head().String())
 	}
 }
+
+// newConfig returns the configuration described by the command line flags
+func newConfig() (*splitter.Config, error) {
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("You must provide the directory to split via the --prefix flag")
+	}
+
+	for _, prefix := range prefixes {
+		prefix.Markers = markers
+		prefix.FollowRenames = followRenames
+	}
+
+	for _, value := range renames {
+		if err := addRename(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return &splitter.Config{
+		Path:            path,
+		Origin:          origin,
+		Prefixes:        prefixes,
+		Target:          target,
+		Commit:          commit,
+		Debug:           debug,
+		Scratch:         scratch,
+		GitVersion:      gitVersion,
+		Push:            push,
+		PushForce:       pushForce,
+		Tags:            tags,
+		TagTarget:       tagTarget,
+		Conflict:        conflict,
+		Rejoin:          rejoin,
+		ReadJoins:       readJoins,
+		Onto:            onto,
+		MessageTemplate: message,
+		Mailmap:         mailmap,
+		MailmapFile:     mailmapFile,
+		Committer:       committer,
+		EmptyEmail:      emptyEmail,
+		Anonymize:       anonymize,
+		SigningKey:      signingKey,
+		SignProgram:     signProgram,
+		SignFormat:      signFormat,
+
+		CheckpointCommits:  checkpointCommits,
+		CheckpointInterval: checkpointInterval,
+		OnRewrite:          onRewrite,
+	}, nil
+}
+
+// manifestFlags are the flags that apply to all the splits of a manifest
+var manifestFlags = map[string]bool{
+	"config":              true,
+	"path":                true,
+	"debug":               true,
+	"scratch":             true,
+	"checkpoint-commits":  true,
+	"checkpoint-interval": true,
+	"on-rewrite":          true,
+	"mappings":            true,
+	"mappings-format":     true,
+	"output":              true,
+}
+
+// splitFlag returns the first flag set on the command line that describes a split (defined by the manifest instead)
+func splitFlag() string {
+	var name string
+	flag.Visit(func(f *flag.Flag) {
+		if name == "" && !manifestFlags[f.Name] {
+			name = f.Name
+		}
+	})
+	return name
+}
+
+func expand(config *splitter.Config) []*splitter.Config {
+	configs, err := splitter.Expand(config)
+	if err != nil {
+		exitWithError(err, nil)
+	}
+	return configs
+}
+
+func addRename(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("the rename value must be formatted as <prefix>:<former-path>[@<last-commit-sha1>]")
+	}
+
+	rename := &splitter.Rename{From: parts[1]}
+	if i := strings.LastIndex(parts[1], "@"); i >= 0 {
+		rename.From, rename.Until = parts[1][:i], parts[1][i+1:]
+	}
+
+	from := strings.TrimRight(parts[0], "/")
+	for _, prefix := range prefixes {
+		if prefix.From == from {
+			prefix.Renames = append(prefix.Renames, rename)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the renamed prefix %s is not one of the split prefixes", parts[0])
+}
+
+// expandedName describes an expanded configuration by what differs from the original one
+func expandedName(name string, original, config *splitter.Config) string {
+	var parts []string
+	if name != "" {
+		parts = append(parts, name)
+	}
+	if config.Origin != original.Origin {
+		parts = append(parts, config.Origin)
+	}
+	for i, prefix := range original.Prefixes {
+		if config.Prefixes[i].From != prefix.From {
+			parts = append(parts, config.Prefixes[i].From)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func splitMany(ctx context.Context, names []string, configs []*splitter.Config) {
+	results, err := splitter.SplitManyContext(ctx, configs)
+	if err != nil {
+		exitWithError(err, nil)
+	}
+
+	if output == "json" {
+		splits := make(map[string]*splitter.Result)
+		for i, name := range names {
+			splits[name] = results[i]
+		}
+		printJSON(&jsonOutput{Splits: splits})
+	}
+
+	for i, name := range names {
+		result := results[i]
+		fmt.Fprintf(os.Stderr, "%s: %d commits created, %d commits traversed, in %s\n", name, result.Created(), result.Traversed(), result.Duration(time.Millisecond))
+
+		if result.Head() != nil && output != "json" {
+			fmt.Printf("%s %s\n", name, result.Head().String())
+		}
+		reportTags(name+": ", result)
+		reportRejoin(name+": ", result)
+		reportPush(name+": ", result)
+	}
+}
+
+// exitWithError displays the error (with the result so far if any) and exits with a distinct code on cancellation
+func exitWithError(err error, result *splitter.Result) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	if output == "json" {
+		printJSON(&jsonOutput{Result: result, Error: &jsonError{Code: errorCode(err), Message: err.Error()}})
+	}
+
+	var canceled *splitter.CanceledError
+	if errors.As(err, &canceled) {
+		os.Exit(exitCanceled)
+	}
+	os.Exit(1)
+}
+
+func reportTags(prefix string, result *splitter.Result) {
+	if tags := result.Tags(); len(tags) > 0 {
+		fmt.Fprintf(os.Stderr, "%s%d tags split\n", prefix, len(tags))
+	}
+}
+
+func reportRejoin(prefix string, result *splitter.Result) {
+	if rejoined := result.Rejoined(); rejoined != nil {
+		fmt.Fprintf(os.Stderr, "%srejoined as %s\n", prefix, rejoined)
+	}
+}
+
+func reportPush(prefix string, result *splitter.Result) {
+	pushed := result.Pushed()
+	if pushed == nil {
+		return
+	}
+
+	old := "(new)"
+	if pushed.Old != nil {
+		old = pushed.Old.String()
+	}
+	fmt.Fprintf(os.Stderr, "%spushed %s to %s (%s -> %s)\n", prefix, pushed.Ref, pushed.Remote, old, pushed.New)
+}
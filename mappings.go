@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/splitsh/lite/splitter"
+)
+
+// openMappings returns the writer of the mappings described by the flags (nil when disabled)
+//
+// The file is left open until the process exits; the writers flush after each split.
+func openMappings(output string) (splitter.MappingWriter, error) {
+	if output == "" {
+		return nil, nil
+	}
+
+	w := io.Writer(os.Stdout)
+	if output != "-" {
+		file, err := os.Create(output)
+		if err != nil {
+			return nil, err
+		}
+		w = file
+	}
+
+	switch mappingsFormat {
+	case "json":
+		return splitter.NewJSONMappingWriter(w), nil
+	case "csv":
+		return splitter.NewCSVMappingWriter(w), nil
+	}
+
+	return nil, fmt.Errorf("unsupported mappings format %s, must be json or csv", mappingsFormat)
+}
+
+// exportCommand writes the cached mappings of the split described by the flags and returns the exit code
+func exportCommand(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 1
+	}
+
+	config, err := newConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	output := mappingsFile
+	if output == "" {
+		output = "-"
+	}
+	w, err := openMappings(output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	for _, c := range expand(config) {
+		c.Name = expandedName("", config, c)
+		if err := splitter.Export(c, w); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/splitsh/lite/splitter"
+)
+
+// jsonOutput is the document displayed on stdout with --output=json
+type jsonOutput struct {
+	Result *splitter.Result            `json:"result,omitempty"`
+	Splits map[string]*splitter.Result `json:"splits,omitempty"`
+	Error  *jsonError                  `json:"error,omitempty"`
+}
+
+type jsonError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func printJSON(document *jsonOutput) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(document)
+}
+
+// errorCode returns the code of an error for the JSON output
+func errorCode(err error) string {
+	var canceled *splitter.CanceledError
+	var conflict *splitter.ConflictError
+	var rewritten *splitter.RewrittenError
+	var config *splitter.ConfigError
+
+	switch {
+	case errors.As(err, &canceled):
+		return "canceled"
+	case errors.As(err, &conflict):
+		return "conflict"
+	case errors.As(err, &rewritten):
+		return "rewritten"
+	case errors.As(err, &config):
+		return "invalid_config"
+	}
+
+	return "error"
+}
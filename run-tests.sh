@@ -186,6 +186,985 @@ filemodeTest() {
     cd ../
 }
 
+pushTest() {
+    rm -rf push push.git
+    git init --bare push.git > /dev/null
+    mkdir push
+    cd push
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir b/
+    echo "b" > b/b
+    git add b
+    git commit -m"added b" > /dev/null
+
+    GIT_SPLITSH_SHA1=`$LITE_PATH --prefix=b/ --push=../push.git:main 2>/dev/null`
+    GIT_PUSHED_SHA1=`git --git-dir=../push.git rev-parse refs/heads/main`
+
+    if [ "$GIT_SPLITSH_SHA1" != "$GIT_PUSHED_SHA1" ]; then
+        echo "Test #7 - NOT OK ($GIT_SPLITSH_SHA1 != $GIT_PUSHED_SHA1)"
+        exit 1
+    fi
+
+    # the remote has diverged
+    GIT_OTHER_SHA1=`git commit-tree HEAD:b -m"other"`
+    git push -q --force ../push.git $GIT_OTHER_SHA1:refs/heads/main
+
+    if $LITE_PATH --prefix=b/ --push=../push.git:main > /dev/null 2>&1; then
+        echo "Test #7 - NOT OK (non fast-forward push accepted)"
+        exit 1
+    fi
+    GIT_REJECTED_SHA1=`git --git-dir=../push.git rev-parse refs/heads/main`
+
+    $LITE_PATH --prefix=b/ --push=../push.git:main --push-force > /dev/null 2>&1
+    GIT_FORCED_SHA1=`git --git-dir=../push.git rev-parse refs/heads/main`
+
+    if [ "$GIT_REJECTED_SHA1" == "$GIT_OTHER_SHA1" ] && [ "$GIT_FORCED_SHA1" == "$GIT_SPLITSH_SHA1" ]; then
+        echo "Test #7 - OK ($GIT_SPLITSH_SHA1 == $GIT_PUSHED_SHA1)"
+    else
+        echo "Test #7 - NOT OK ($GIT_REJECTED_SHA1 != $GIT_OTHER_SHA1 or $GIT_FORCED_SHA1 != $GIT_SPLITSH_SHA1)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+tagsTest() {
+    rm -rf tags
+    mkdir tags
+    cd tags
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir b/
+    echo "b" > b/b
+    git add b
+    git commit -m"added b" > /dev/null
+    git tag -a v1.0 -m"version 1.0"
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "bb" > b/b
+    git add b
+    git commit -m"updated b" > /dev/null
+    git tag v1.1
+
+    GIT_SPLITSH_SHA1=`$LITE_PATH --prefix=b/ --tags='v*' --tag-target='refs/tags/split/{tag}' 2>/dev/null`
+    GIT_TAG_SHA1=`git rev-parse 'split/v1.1^{commit}'`
+    GIT_TAG_MESSAGE=`git tag -l --format='%(contents:subject)' split/v1.0`
+    OUTPUT=`$LITE_PATH --prefix=b/ --tags='v*' --tag-target='refs/tags/split/{tag}' --output=json 2>/dev/null`
+
+    if [ "$GIT_SPLITSH_SHA1" == "$GIT_TAG_SHA1" ] && [ "$GIT_TAG_MESSAGE" == "version 1.0" ] && ! echo "$OUTPUT" | grep -q '"tags"'; then
+        echo "Test #8 - OK ($GIT_SPLITSH_SHA1 == $GIT_TAG_SHA1)"
+    else
+        echo "Test #8 - NOT OK ($GIT_SPLITSH_SHA1 != $GIT_TAG_SHA1)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+excludesTest() {
+    rm -rf excludes
+    mkdir excludes
+    cd excludes
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir -p b/tests/fixtures b/src
+    echo "b" > b/src/b
+    echo "b" > b/src/b.snap
+    echo "r" > b/README
+    echo "r" > b/src/README
+    echo "t" > b/tests/t
+    echo "f" > b/tests/fixtures/f
+    git add b
+    git commit -m"added b" > /dev/null
+
+    $LITE_PATH --prefix='b/::tests/fixtures:*.snap:/README' --target refs/heads/split 2>/dev/null
+    FILES=`git ls-tree -r --name-only split | tr '\n' ' '`
+
+    if test "$FILES" = "src/README src/b tests/t "; then
+        echo "Test #9 - OK"
+    else
+        echo "Test #9 - NOT OK ($FILES)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+includesTest() {
+    rm -rf includes
+    mkdir includes
+    cd includes
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir -p b/src b/tools
+    echo "b" > b/src/b
+    echo "l" > b/LICENSE
+    echo "t" > b/tools/t
+    git add b
+    git commit -m"added b" > /dev/null
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "tt" > b/tools/t
+    git add b
+    git commit -m"updated tools" > /dev/null
+
+    $LITE_PATH --prefix='b/::+src:+LICENSE' --target refs/heads/split 2>/dev/null
+    FILES=`git ls-tree -r --name-only split | tr '\n' ' '`
+    COMMITS=`git rev-list --count split`
+
+    if test "$FILES" = "LICENSE src/b " && test "$COMMITS" = "1"; then
+        echo "Test #10 - OK"
+    else
+        echo "Test #10 - NOT OK ($FILES, $COMMITS commits)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+filePrefixTest() {
+    rm -rf fileprefix
+    mkdir fileprefix
+    cd fileprefix
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir b/
+    echo "b" > b/b
+    echo "l" > LICENSE
+    git add b LICENSE
+    git commit -m"added b" > /dev/null
+
+    $LITE_PATH --prefix=b/ --prefix=LICENSE:legal/LICENSE --target refs/heads/split 2>/dev/null
+    FILES=`git ls-tree -r --name-only split | tr '\n' ' '`
+
+    if test "$FILES" = "b legal/LICENSE "; then
+        echo "Test #11 - OK"
+    else
+        echo "Test #11 - NOT OK ($FILES)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+renamesTest() {
+    rm -rf renames
+    mkdir renames
+    cd renames
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir -p lib/foo
+    echo "a" > lib/foo/a
+    git add lib
+    git commit -m"added foo" > /dev/null
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    mkdir packages
+    git mv lib/foo packages/foo
+    git commit -m"moved foo" > /dev/null
+
+    switchAsFred "Sat, 24 Nov 1973 21:01:02 +0200" "Sat, 24 Nov 1973 21:11:22 +0200"
+    echo "aa" > packages/foo/a
+    git add packages
+    git commit -m"updated foo" > /dev/null
+
+    $LITE_PATH --prefix=packages/foo --follow-renames --target refs/heads/split 2>/dev/null
+    COMMITS=`git rev-list --count split`
+
+    if test "$COMMITS" = "2"; then
+        echo "Test #12 - OK"
+    else
+        echo "Test #12 - NOT OK ($COMMITS commits)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+conflictTest() {
+    rm -rf conflict
+    mkdir conflict
+    cd conflict
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir -p a/b b/
+    echo "a" > a/b/README
+    echo "b" > b/README
+    git add a b
+    git commit -m"added a and b" > /dev/null
+
+    if $LITE_PATH --prefix=a/ --prefix=b/:b 2>/dev/null; then
+        echo "Test #13 - NOT OK (conflict not detected)"
+        exit 1
+    fi
+
+    $LITE_PATH --prefix=a/ --prefix=b/:b --conflict=last --target refs/heads/split 2>/dev/null
+    README=`git show split:b/README`
+
+    # both prefixes at the root
+    echo "a" > a/README
+    git add a
+    git commit -m"added a README" > /dev/null
+    $LITE_PATH --prefix=a/ --prefix=b/ --conflict=last --target refs/heads/root 2>/dev/null
+    ROOT=`git show root:README`
+
+    if test "$README" = "b" && test "$ROOT" = "b"; then
+        echo "Test #13 - OK"
+    else
+        echo "Test #13 - NOT OK ($README, $ROOT)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+rejoinTest() {
+    rm -rf rejoin
+    mkdir rejoin
+    cd rejoin
+    git init > /dev/null
+    git config user.name "Fred Foobar"
+    git config user.email "fred.foobar@example.com"
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+
+    SPLIT=`$LITE_PATH --prefix=a/ --rejoin 2>/dev/null`
+    TRAILER=`git log -1 --format=%B | grep git-subtree-split`
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "aa" > a/a
+    git add a
+    git commit -m"updated a" > /dev/null
+
+    $LITE_PATH --prefix=a/ --read-joins --target refs/heads/split 2>/dev/null
+    PARENT=`git rev-parse split^`
+
+    if test "$TRAILER" = "git-subtree-split: $SPLIT" && test "$PARENT" = "$SPLIT"; then
+        echo "Test #14 - OK"
+    else
+        echo "Test #14 - NOT OK ($TRAILER, $PARENT)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+ontoTest() {
+    rm -rf onto
+    mkdir onto
+    cd onto
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "aa" > a/a
+    git add a
+    git commit -m"updated a" > /dev/null
+
+    # published by another tool
+    PUBLISHED=`git commit-tree HEAD~1:a -m"published a"`
+
+    $LITE_PATH --prefix=a/ --onto=$PUBLISHED --target refs/heads/split 2>/dev/null
+    PARENT=`git rev-parse split^`
+    PREVIOUS=`git rev-parse split`
+
+    # reverting to the published tree must not move the split back
+    echo "a" > a/a
+    git add a
+    git commit -m"reverted a" > /dev/null
+    $LITE_PATH --prefix=a/ --onto=$PUBLISHED --target refs/heads/split 2>/dev/null
+    REVERTED=`git rev-parse split^`
+
+    if test "$PARENT" = "$PUBLISHED" && test "$REVERTED" = "$PREVIOUS"; then
+        echo "Test #15 - OK"
+    else
+        echo "Test #15 - NOT OK ($PARENT, $REVERTED)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+messageTest() {
+    rm -rf message
+    mkdir message
+    cd message
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a (#12)" > /dev/null
+    ORIGINAL=`git rev-parse HEAD`
+
+    $LITE_PATH --prefix=a/ --message='[a] {{ .Message | replace "#([0-9]+)" "org/repo#${1}" | trailer "Original-Commit" .Original }}' --target refs/heads/split 2>/dev/null
+    MESSAGE=`git log -1 --format=%B split | sed '/^$/d' | tr '\n' '|'`
+
+    if test "$MESSAGE" = "[a] added a (org/repo#12)|Original-Commit: $ORIGINAL|"; then
+        echo "Test #16 - OK"
+    else
+        echo "Test #16 - NOT OK ($MESSAGE)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+identityTest() {
+    rm -rf identity
+    mkdir identity
+    cd identity
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    echo "Sammy <sammy@example.com> <sammy.cobol@example.com>" > .mailmap
+    git add a .mailmap
+    git commit -m"added a" > /dev/null
+
+    $LITE_PATH --prefix=a/ --mailmap --committer="Split Bot <bot@example.com>" --target refs/heads/split 2>/dev/null
+    AUTHOR=`git log -1 --format='%an <%ae>' split`
+    COMMITTER=`git log -1 --format='%cn <%ce> %cd' split`
+    ORIGINAL_DATE=`git log -1 --format='%cd'`
+
+    if test "$AUTHOR" = "Sammy <sammy@example.com>" && test "$COMMITTER" = "Split Bot <bot@example.com> $ORIGINAL_DATE"; then
+        echo "Test #17 - OK"
+    else
+        echo "Test #17 - NOT OK ($AUTHOR, $COMMITTER)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+signTest() {
+    rm -rf sign
+    mkdir sign
+    cd sign
+    git init > /dev/null
+    rm -f ../sign-key ../sign-key.pub
+    ssh-keygen -q -t ed25519 -N "" -f ../sign-key
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+
+    $LITE_PATH --prefix=a/ --signing-key=../sign-key --sign-format=ssh --target refs/heads/split 2>/dev/null
+
+    if git cat-file -p split | grep -q "^gpgsig -----BEGIN SSH SIGNATURE-----"; then
+        echo "Test #18 - OK"
+    else
+        echo "Test #18 - NOT OK"
+        exit 1
+    fi
+
+    rm -f ../sign-key ../sign-key.pub
+    cd ../
+}
+
+cacheTest() {
+    rm -rf cache
+    mkdir cache
+    cd cache
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+
+    $LITE_PATH --prefix=a/ > /dev/null 2>&1
+    KEY=`$LITE_PATH cache list | grep ' a (git latest)$' | cut -d' ' -f1`
+    MAPPINGS=`$LITE_PATH cache show $KEY | grep mappings:`
+    KEPT=`git for-each-ref refs/splitsh/$KEY | wc -l | tr -d ' '`
+    $LITE_PATH cache drop $KEY
+    BUCKETS=`$LITE_PATH cache list | wc -l | tr -d ' '`
+    REFS=`git for-each-ref refs/splitsh | wc -l | tr -d ' '`
+
+    if test "$MAPPINGS" = "mappings: 1" && test "$BUCKETS" = "0" && test "$KEPT" = "1" && test "$REFS" = "0"; then
+        echo "Test #19 - OK"
+    else
+        echo "Test #19 - NOT OK ($KEY, $MAPPINGS, $BUCKETS buckets, $KEPT/$REFS refs)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+checkpointTest() {
+    rm -rf checkpoint
+    mkdir checkpoint
+    cd checkpoint
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/ b/
+    echo "a" > a/a
+    echo "b" > b/README
+    git add a b
+    git commit -m"added a and b" > /dev/null
+    FIRST=`git rev-parse HEAD`
+
+    # the split fails on the second commit
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    mkdir a/b
+    echo "a" > a/b/README
+    git add a
+    git commit -m"added a conflict" > /dev/null
+
+    $LITE_PATH --prefix=a/ --prefix=b/:b --checkpoint-commits=1 > /dev/null 2>&1 || true
+    HEAD=`$LITE_PATH cache list | cut -d' ' -f1 | xargs -n1 $LITE_PATH cache show | grep "^head: .* $FIRST$"`
+
+    if test "$HEAD" != ""; then
+        echo "Test #20 - OK"
+    else
+        echo "Test #20 - NOT OK ($HEAD)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+rewriteTest() {
+    rm -rf rewrite
+    mkdir rewrite
+    cd rewrite
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "aa" > a/a
+    git add a
+    git commit -m"updated a" > /dev/null
+
+    $LITE_PATH --prefix=a/ > /dev/null 2>&1
+
+    # force push
+    git reset --hard HEAD~1 > /dev/null
+    echo "ab" > a/a
+    git add a
+    git commit -m"updated a differently" > /dev/null
+
+    if $LITE_PATH --prefix=a/ --on-rewrite=fail > /dev/null 2>&1; then
+        echo "Test #21 - NOT OK (rewrite not detected)"
+        exit 1
+    fi
+
+    SPLIT=`$LITE_PATH --prefix=a/ 2>/dev/null`
+    CONTENT=`git show $SPLIT:a`
+
+    if test "$CONTENT" = "ab"; then
+        echo "Test #21 - OK"
+    else
+        echo "Test #21 - NOT OK ($CONTENT)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+gcTest() {
+    rm -rf gc
+    mkdir gc
+    cd gc
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+
+    SPLIT=`$LITE_PATH --prefix=a/ 2>/dev/null`
+    git gc --prune=now -q
+    KEPT=`git cat-file -t $SPLIT`
+
+    # pruned anyway
+    git for-each-ref --format='%(refname)' refs/splitsh | xargs -n1 git update-ref -d
+    git gc --prune=now -q
+    RESPLIT=`$LITE_PATH --prefix=a/ 2>/dev/null`
+    RECREATED=`git cat-file -t $RESPLIT`
+
+    if test "$KEPT" = "commit" && test "$RESPLIT" = "$SPLIT" && test "$RECREATED" = "commit"; then
+        echo "Test #22 - OK"
+    else
+        echo "Test #22 - NOT OK ($KEPT, $RESPLIT, $RECREATED)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+verifyTest() {
+    rm -rf verify
+    mkdir verify
+    cd verify
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+
+    SPLIT=`$LITE_PATH --prefix=a/ 2>/dev/null`
+    if ! $LITE_PATH verify --prefix=a/ > /dev/null 2>&1; then
+        echo "Test #23 - NOT OK (consistent cache reported as inconsistent)"
+        exit 1
+    fi
+    if $LITE_PATH verify --prefix=b/ > /dev/null 2>&1 || test "`$LITE_PATH cache list | wc -l | tr -d ' '`" != "1"; then
+        echo "Test #23 - NOT OK (verify created a bucket)"
+        exit 1
+    fi
+
+    # prune the split commit
+    git for-each-ref --format='%(refname)' refs/splitsh | xargs -n1 git update-ref -d
+    git gc --prune=now -q
+
+    MISMATCHES=`($LITE_PATH verify --prefix=a/ 2>/dev/null || true) | wc -l | tr -d ' '`
+    REPAIRED=`$LITE_PATH verify --prefix=a/ --repair 2>/dev/null | grep -c "repaired as $SPLIT"`
+
+    if test "$MISMATCHES" = "1" && test "$REPAIRED" = "1"; then
+        echo "Test #23 - OK"
+    else
+        echo "Test #23 - NOT OK ($MISMATCHES, $REPAIRED)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+lookupTest() {
+    rm -rf lookup
+    mkdir lookup
+    cd lookup
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+    ORIGINAL=`git rev-parse HEAD`
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "b" > b
+    git add b
+    git commit -m"added b" > /dev/null
+
+    SPLIT=`$LITE_PATH --prefix=a/ 2>/dev/null`
+    SHORT=`echo $SPLIT | cut -c1-7`
+    FOUND=`$LITE_PATH lookup --prefix=a/ --split=$SHORT 2>/dev/null`
+
+    if test "$FOUND" = "$ORIGINAL $SPLIT"; then
+        echo "Test #24 - OK"
+    else
+        echo "Test #24 - NOT OK ($FOUND)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+mappingsTest() {
+    rm -rf mappings
+    mkdir mappings
+    cd mappings
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+    ORIGINAL=`git rev-parse HEAD`
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "b" > b
+    git add b
+    git commit -m"added b" > /dev/null
+    SKIPPED=`git rev-parse HEAD`
+
+    SPLIT=`$LITE_PATH --prefix=a/ --mappings=mappings.csv --mappings-format=csv 2>/dev/null`
+    EXPECTED="original,split,status,name
+$ORIGINAL,$SPLIT,created,a
+$SKIPPED,$SPLIT,skipped,a"
+    EXPORTED=`$LITE_PATH export --prefix=a/ 2>/dev/null | wc -l | tr -d ' '`
+
+    if test "`cat mappings.csv`" = "$EXPECTED" && test "$EXPORTED" = "2"; then
+        echo "Test #25 - OK"
+    else
+        echo "Test #25 - NOT OK (`cat mappings.csv`, $EXPORTED exported)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+outputTest() {
+    rm -rf output
+    mkdir output
+    cd output
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+    $LITE_PATH --prefix=a/ --target=refs/heads/split > /dev/null 2>&1
+    OLD=`git rev-parse split`
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "aa" > a/a
+    git add a
+    git commit -m"updated a" > /dev/null
+
+    OUTPUT=`$LITE_PATH --prefix=a/ --target=refs/heads/split --output=json 2>/dev/null`
+    HEAD=`git rev-parse split`
+    FAILURE=`$LITE_PATH --prefix=a/ --on-rewrite=unknown --output=json 2>/dev/null || true`
+
+    if echo "$OUTPUT" | grep -q "\"head\": \"$HEAD\"" && echo "$OUTPUT" | grep -q "\"old_target\": \"$OLD\"" && echo "$OUTPUT" | grep -q '"created": 1' && echo "$FAILURE" | grep -q '"code": "invalid_config"'; then
+        echo "Test #26 - OK"
+    else
+        echo "Test #26 - NOT OK ($OUTPUT $FAILURE)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+manifestCheckpointTest() {
+    rm -rf manifest-checkpoint manifest-checkpoint-single
+    mkdir manifest-checkpoint
+    cd manifest-checkpoint
+    git init > /dev/null
+
+    cat > splitsh.yml <<CONFIG
+splits:
+  - name: a
+    prefixes:
+      - from: a
+    target: heads/split/a
+  - name: b
+    prefixes:
+      - from: b
+    target: heads/split/b
+CONFIG
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/ b/
+    for i in `seq 1 100`; do
+        echo "$i" > a/a
+        echo "$i" > b/b
+        git add a b
+        git commit -m"commit $i" > /dev/null
+    done
+
+    # checkpointing each split commit grows the database while other caches are in use
+    $LITE_PATH --config=splitsh.yml --checkpoint-commits=1 > /dev/null 2>&1
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    for i in `seq 101 150`; do
+        echo "$i" > a/a
+        echo "$i" > b/b
+        git add a b
+        git commit -m"commit $i" > /dev/null
+    done
+
+    $LITE_PATH --config=splitsh.yml --checkpoint-commits=1 > /dev/null 2>&1
+    SPLIT_A=`git rev-parse split/a`
+    SPLIT_B=`git rev-parse split/b`
+
+    git clone -q . ../manifest-checkpoint-single
+    cd ../manifest-checkpoint-single
+    EXPECTED_A=`$LITE_PATH --prefix=a/ 2>/dev/null`
+    EXPECTED_B=`$LITE_PATH --prefix=b/ 2>/dev/null`
+
+    if test "$SPLIT_A" = "$EXPECTED_A" && test "$SPLIT_B" = "$EXPECTED_B"; then
+        echo "Test #27 - OK"
+    else
+        echo "Test #27 - NOT OK ($SPLIT_A vs $EXPECTED_A, $SPLIT_B vs $EXPECTED_B)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+manifestTest() {
+    rm -rf manifest
+    mkdir manifest
+    cd manifest
+    git init > /dev/null
+
+    cat > splitsh.yml <<CONFIG
+splits:
+  - name: a
+    prefixes:
+      - from: a
+        excludes: [tests]
+    target: heads/split/a
+  - name: b
+    prefixes:
+      - from: b/src
+        to: src
+      - from: b/docs
+        to: docs
+    target: heads/split/b
+CONFIG
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir -p a/tests b/src b/docs
+    echo "a" > a/a
+    echo "t" > a/tests/t
+    echo "b" > b/src/b
+    git add a b
+    git commit -m"added a and b" > /dev/null
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "d" > b/docs/d
+    echo "aa" > a/a
+    git add a b
+    git commit -m"updated a and b" > /dev/null
+
+    $LITE_PATH --config=splitsh.yml > /dev/null 2>&1
+    SPLIT_A=`git rev-parse split/a`
+    SPLIT_B=`git rev-parse split/b`
+    EXPECTED_A=`$LITE_PATH --prefix=a/::tests --scratch 2>/dev/null`
+    EXPECTED_B=`$LITE_PATH --prefix=b/src:src --prefix=b/docs:docs --scratch 2>/dev/null`
+
+    if test "$SPLIT_A" = "$EXPECTED_A" && test "$SPLIT_B" = "$EXPECTED_B"; then
+        echo "Test #28 - OK"
+    else
+        echo "Test #28 - NOT OK ($SPLIT_A vs $EXPECTED_A, $SPLIT_B vs $EXPECTED_B)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+splitManyTest() {
+    rm -rf split-many
+    mkdir split-many
+    cd split-many
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/ b/
+    echo "a" > a/a
+    echo "b" > b/b
+    git add a b
+    git commit -m"added a and b" > /dev/null
+    START=`git rev-parse HEAD`
+    git branch feature
+
+    echo "aa" > a/a
+    git add a
+    git commit -m"updated a" > /dev/null
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    git checkout -q feature
+    echo "fa" > a/fa
+    echo "fb" > b/fb
+    git add a b
+    git commit -m"added features" > /dev/null
+    git checkout -q -
+
+    # the a splits share a bucket with different ranges, b starts at a given commit
+    cat > splitsh.yml <<CONFIG
+splits:
+  - name: a
+    prefixes:
+      - from: a
+    target: heads/split/a
+  - name: a-feature
+    origin: heads/feature
+    prefixes:
+      - from: a
+    target: heads/split/a-feature
+  - name: b-feature
+    origin: heads/feature
+    commit: $START
+    prefixes:
+      - from: b
+    target: heads/split/b-feature
+CONFIG
+
+    $LITE_PATH --config=splitsh.yml > /dev/null 2>&1
+
+    # incremental split, after a merge
+    git merge -q --no-edit feature > /dev/null
+    echo "aaa" > a/a
+    git add a
+    git commit -m"updated a again" > /dev/null
+    git checkout -q feature
+    echo "fb2" > b/fb
+    git add b
+    git commit -m"updated b" > /dev/null
+    git checkout -q -
+
+    $LITE_PATH --config=splitsh.yml > /dev/null 2>&1
+    SPLITS="`git rev-parse split/a` `git rev-parse split/a-feature` `git rev-parse split/b-feature`"
+
+    EXPECTED="`$LITE_PATH --prefix=a/ --scratch 2>/dev/null`"
+    EXPECTED="$EXPECTED `$LITE_PATH --prefix=a/ --origin=heads/feature --scratch 2>/dev/null`"
+    EXPECTED="$EXPECTED `$LITE_PATH --prefix=b/ --origin=heads/feature --commit=$START --scratch 2>/dev/null`"
+
+    # typos in the manifest and split flags are rejected
+    sed 's/target:/tagret:/' splitsh.yml > typo.yml
+    TYPO=0
+    $LITE_PATH --config=typo.yml > /dev/null 2>&1 || TYPO=$?
+    FLAG=0
+    $LITE_PATH --config=splitsh.yml --origin=heads/feature > /dev/null 2>&1 || FLAG=$?
+
+    if test "$SPLITS" = "$EXPECTED" && [ $TYPO -ne 0 ] && [ $FLAG -ne 0 ]; then
+        echo "Test #29 - OK"
+    else
+        echo "Test #29 - NOT OK ($SPLITS vs $EXPECTED)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+originPatternTest() {
+    rm -rf origin-pattern
+    mkdir origin-pattern
+    cd origin-pattern
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+    git branch release/1.x
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "aa" > a/a
+    git add a
+    git commit -m"updated a" > /dev/null
+    git branch release/2.x
+
+    $LITE_PATH --prefix=a/ --origin='heads/release/*' --target='refs/heads/split/{branch}' > /dev/null 2>&1
+    SPLITS="`git rev-parse split/1.x` `git rev-parse split/2.x`"
+    EXPECTED="`$LITE_PATH --prefix=a/ --origin=heads/release/1.x --scratch 2>/dev/null`"
+    EXPECTED="$EXPECTED `$LITE_PATH --prefix=a/ --origin=heads/release/2.x --scratch 2>/dev/null`"
+
+    if test "$SPLITS" = "$EXPECTED"; then
+        echo "Test #30 - OK"
+    else
+        echo "Test #30 - NOT OK ($SPLITS vs $EXPECTED)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+prefixPatternTest() {
+    rm -rf prefix-pattern
+    mkdir prefix-pattern
+    cd prefix-pattern
+    git init > /dev/null
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir -p packages/foo packages/bar packages/baz
+    echo "foo" > packages/foo/composer.json
+    echo "bar" > packages/bar/composer.json
+    echo "baz" > packages/baz/README
+    git add packages
+    git commit -m"added packages" > /dev/null
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "foo" > packages/foo/foo
+    git add packages
+    git commit -m"updated foo" > /dev/null
+
+    $LITE_PATH --prefix='packages/*' --marker=composer.json --target='refs/heads/split/{name}' > /dev/null 2>&1
+    SPLITS="`git rev-parse split/bar` `git rev-parse split/foo`"
+    EXPECTED="`$LITE_PATH --prefix=packages/bar/ --scratch 2>/dev/null`"
+    EXPECTED="$EXPECTED `$LITE_PATH --prefix=packages/foo/ --scratch 2>/dev/null`"
+
+    if test "$SPLITS" = "$EXPECTED" && ! git rev-parse -q --verify split/baz > /dev/null; then
+        echo "Test #31 - OK"
+    else
+        echo "Test #31 - NOT OK ($SPLITS vs $EXPECTED)"
+        exit 1
+    fi
+
+    cd ../
+}
+
+cancelTest() {
+    rm -rf cancel
+    mkdir cancel
+    cd cancel
+    git init > /dev/null
+
+    # a signing program interrupting the split when signing the first commit
+    cat > ../cancel-sign <<SCRIPT
+#!/bin/sh
+cat > /dev/null
+kill -INT \$PPID
+sleep 1
+echo "signature"
+SCRIPT
+    chmod +x ../cancel-sign
+
+    switchAsSammy "Sat, 24 Nov 1973 19:01:02 +0200" "Sat, 24 Nov 1973 19:11:22 +0200"
+    mkdir a/
+    echo "a" > a/a
+    git add a
+    git commit -m"added a" > /dev/null
+    FIRST=`git rev-parse HEAD`
+
+    switchAsFred "Sat, 24 Nov 1973 20:01:02 +0200" "Sat, 24 Nov 1973 20:11:22 +0200"
+    echo "aa" > a/a
+    git add a
+    git commit -m"updated a" > /dev/null
+
+    CODE=0
+    $LITE_PATH --prefix=a/ --signing-key=key --sign-program=../cancel-sign > /dev/null 2>&1 || CODE=$?
+    HEAD=`$LITE_PATH cache list | cut -d' ' -f1 | xargs -n1 $LITE_PATH cache show | grep "^head: .* $FIRST$"`
+
+    if test "$CODE" = "130" && test "$HEAD" != ""; then
+        echo "Test #32 - OK"
+    else
+        echo "Test #32 - NOT OK ($CODE, $HEAD)"
+        exit 1
+    fi
+
+    rm -f ../cancel-sign
+    cd ../
+}
+
 LITE_PATH=`pwd`/splitsh-lite
 if [ ! -e $LITE_PATH ]; then
     echo "You first need to compile the splitsh-lite binary"
@@ -201,3 +1180,29 @@ simpleTest
 mergeTest
 twigSplitTest
 filemodeTest
+pushTest
+tagsTest
+excludesTest
+includesTest
+filePrefixTest
+renamesTest
+conflictTest
+rejoinTest
+ontoTest
+messageTest
+identityTest
+signTest
+cacheTest
+checkpointTest
+rewriteTest
+gcTest
+verifyTest
+lookupTest
+mappingsTest
+outputTest
+manifestCheckpointTest
+manifestTest
+splitManyTest
+originPatternTest
+prefixPatternTest
+cancelTest
@@ -0,0 +1,244 @@
+package splitter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/libgit2/git2go/v34"
+	bolt "go.etcd.io/bbolt"
+)
+
+// metaKey stores the bucket metadata (sha1 keys are 20 bytes long)
+var metaKey = []byte("meta")
+
+// BucketMeta describes the configuration a cache bucket belongs to
+type BucketMeta struct {
+	Prefixes []string  `json:"prefixes"`
+	Git      string    `json:"git"`
+	Commit   string    `json:"commit,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Bucket describes a cache bucket
+type Bucket struct {
+	Key string
+	// Meta is nil for buckets created by older versions
+	Meta     *BucketMeta
+	Mappings int
+	// Heads are the last split commits by origin
+	Heads map[string]*git.Oid
+}
+
+func newBucketMeta(config *Config) *BucketMeta {
+	meta := &BucketMeta{
+		Git:     config.GitVersion,
+		Commit:  config.Commit,
+		Updated: time.Now().UTC().Truncate(time.Second),
+	}
+	for _, prefix := range config.Prefixes {
+		meta.Prefixes = append(meta.Prefixes, formatPrefix(prefix))
+	}
+	return meta
+}
+
+// formatPrefix formats a prefix like the --prefix flag
+func formatPrefix(prefix *Prefix) string {
+	parts := []string{prefix.From, prefix.To}
+	parts = append(parts, prefix.Excludes...)
+	for _, include := range prefix.Includes {
+		parts = append(parts, "+"+include)
+	}
+	return strings.TrimRight(strings.Join(parts, ":"), ":")
+}
+
+func putBucketMeta(b *bolt.Bucket, meta *BucketMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return b.Put(metaKey, data)
+}
+
+// isMappingKey returns true for the keys of the original to split commit mappings
+//
+// The other keys (like head/refs/heads/main) can also be 20 bytes long.
+func isMappingKey(k []byte) bool {
+	if len(k) != 20 {
+		return false
+	}
+
+	return !bytes.HasPrefix(k, []byte("head/")) && !bytes.HasPrefix(k, []byte("split/")) && !bytes.Equal(k, metaKey)
+}
+
+func readBucket(key []byte, b *bolt.Bucket) (*Bucket, error) {
+	bucket := &Bucket{
+		Key:   hex.EncodeToString(key),
+		Heads: make(map[string]*git.Oid),
+	}
+
+	if data := b.Get(metaKey); data != nil {
+		bucket.Meta = &BucketMeta{}
+		if err := json.Unmarshal(data, bucket.Meta); err != nil {
+			return nil, fmt.Errorf("invalid metadata for bucket %s: %s", bucket.Key, err)
+		}
+	}
+
+	err := b.ForEach(func(k, v []byte) error {
+		if strings.HasPrefix(string(k), "head/") {
+			bucket.Heads[strings.TrimPrefix(string(k), "head/")] = git.NewOidFromBytes(v)
+		} else if isMappingKey(k) {
+			bucket.Mappings++
+		}
+		return nil
+	})
+
+	return bucket, err
+}
+
+// ListBuckets returns the cache buckets of a repository
+func ListBuckets(path string) ([]*Bucket, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var buckets []*Bucket
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(key []byte, b *bolt.Bucket) error {
+			bucket, err := readBucket(key, b)
+			if err != nil {
+				return err
+			}
+			buckets = append(buckets, bucket)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Key < buckets[j].Key
+	})
+
+	return buckets, nil
+}
+
+// GetBucket returns a cache bucket by its key or a unique prefix of it
+func GetBucket(path, key string) (*Bucket, error) {
+	buckets, err := ListBuckets(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return findBucket(buckets, key)
+}
+
+func findBucket(buckets []*Bucket, key string) (*Bucket, error) {
+	var found *Bucket
+	for _, bucket := range buckets {
+		if !strings.HasPrefix(bucket.Key, strings.ToLower(key)) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("the bucket key %s is ambiguous", key)
+		}
+		found = bucket
+	}
+
+	if found == nil || key == "" {
+		return nil, fmt.Errorf("no bucket matches %s", key)
+	}
+
+	return found, nil
+}
+
+// DropBucket removes a cache bucket by its key or a unique prefix of it
+func DropBucket(path, key string) error {
+	bucket, err := GetBucket(path, key)
+	if err != nil {
+		return err
+	}
+
+	raw, err := hex.DecodeString(bucket.Key)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(raw)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the split commits are not protected from git gc anymore
+	repo, err := git.OpenRepository(path)
+	if err != nil {
+		return err
+	}
+	defer repo.Free()
+
+	return deleteKeepRefs(repo, bucket.Key)
+}
+
+// CompactCache rewrites the cache database to reclaim the unused space
+//
+// The sizes of the database before and after the compaction are returned.
+func CompactCache(path string) (int64, int64, error) {
+	file := filepath.Join(GitDirectory(path), "splitsh.db")
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	src, err := openDB(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tmp := file + ".compact"
+	os.Remove(tmp)
+	dst, err := bolt.Open(tmp, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		src.Close()
+		return 0, 0, err
+	}
+
+	err = bolt.Compact(dst, src, 65536)
+	if err1 := dst.Close(); err == nil {
+		err = err1
+	}
+	// the database must be closed (and its lock released) before being replaced
+	src.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return 0, 0, err
+	}
+
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return 0, 0, err
+	}
+
+	compacted, err := os.Stat(file)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return info.Size(), compacted.Size(), nil
+}
@@ -13,34 +13,65 @@ import (
 )
 
 type cache struct {
-	key    []byte
-	branch string
-	db     *bolt.DB
-	data   map[string][]byte
+	key  []byte
+	meta *BucketMeta
+	db   *bolt.DB
+	data map[string][]byte
+	// readOnly caches never write to the database
+	readOnly bool
 }
 
-func newCache(branch string, config *Config) (*cache, error) {
+func openDB(path string) (*bolt.DB, error) {
+	return bolt.Open(filepath.Join(GitDirectory(path), "splitsh.db"), 0644, &bolt.Options{Timeout: 5 * time.Second})
+}
+
+// newCache returns the cache of a configuration, creating its bucket unless readOnly is true
+func newCache(config *Config, readOnly bool) (*cache, error) {
 	var err error
 	db := config.DB
 	if db == nil {
-		db, err = bolt.Open(filepath.Join(GitDirectory(config.Path), "splitsh.db"), 0644, &bolt.Options{Timeout: 5 * time.Second})
+		db, err = openDB(config.Path)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	c := &cache{
-		db:     db,
-		branch: branch,
-		key:    key(config),
-		data:   make(map[string][]byte),
+		db:   db,
+		key:  key(config),
+		meta: newBucketMeta(config),
+		data: make(map[string][]byte),
+
+		readOnly: readOnly,
+	}
+
+	if readOnly {
+		err = db.View(func(tx *bolt.Tx) error {
+			if tx.Bucket(c.key) == nil {
+				return fmt.Errorf("no cache for this configuration")
+			}
+			return nil
+		})
+		if err != nil {
+			if config.DB == nil {
+				db.Close()
+			}
+			return nil, err
+		}
+		return c, nil
 	}
 
 	err = db.Update(func(tx *bolt.Tx) error {
-		_, err1 := tx.CreateBucketIfNotExists(c.key)
-		return err1
+		b, err1 := tx.CreateBucketIfNotExists(c.key)
+		if err1 != nil {
+			return err1
+		}
+		return putBucketMeta(b, c.meta)
 	})
 	if err != nil {
+		if config.DB == nil {
+			db.Close()
+		}
 		return nil, fmt.Errorf("impossible to create bucket: %s", err)
 	}
 
@@ -48,7 +79,20 @@ func newCache(branch string, config *Config) (*cache, error) {
 }
 
 func (c *cache) close() error {
-	err := c.db.Update(func(tx *bolt.Tx) error {
+	if err := c.save(); err != nil {
+		return err
+	}
+
+	return c.db.Close()
+}
+
+// save persists the in-memory data to the database
+func (c *cache) save() error {
+	if c.readOnly {
+		return nil
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
 		for k, v := range c.data {
 			if err := tx.Bucket(c.key).Put([]byte(k), v); err != nil {
 				return err
@@ -56,11 +100,17 @@ func (c *cache) close() error {
 		}
 		return nil
 	})
-	if err != nil {
+}
+
+// checkpoint persists the in-memory data and releases it
+func (c *cache) checkpoint() error {
+	if err := c.save(); err != nil {
 		return err
 	}
 
-	return c.db.Close()
+	c.data = make(map[string][]byte)
+
+	return nil
 }
 
 func key(config *Config) []byte {
@@ -74,31 +124,86 @@ func key(config *Config) []byte {
 
 	io.WriteString(h, strconv.Itoa(config.Git))
 
+	if config.Conflict != "" && config.Conflict != "error" {
+		io.WriteString(h, "conflict:"+config.Conflict)
+	}
+
+	if config.ReadJoins {
+		io.WriteString(h, "joins")
+	}
+
+	if config.Onto != "" {
+		io.WriteString(h, "onto:"+config.Onto)
+	}
+
+	if config.MessageTemplate != "" {
+		io.WriteString(h, "message:"+config.MessageTemplate)
+	}
+
+	if config.Mailmap || config.MailmapFile != "" {
+		io.WriteString(h, "mailmap:"+config.MailmapFile)
+	}
+	if config.Committer != "" {
+		io.WriteString(h, "committer:"+config.Committer)
+	}
+	if config.EmptyEmail != "" && config.EmptyEmail != "nobody@example.com" {
+		io.WriteString(h, "empty-email:"+config.EmptyEmail)
+	}
+	if config.Anonymize {
+		io.WriteString(h, "anonymize")
+	}
+
+	// signatures change the commit sha1s
+	if config.SigningKey != "" {
+		format := config.SignFormat
+		if format == "" {
+			format = "openpgp"
+		}
+		io.WriteString(h, "sign:"+format+":"+config.SigningKey)
+	}
+
 	for _, prefix := range config.Prefixes {
 		io.WriteString(h, prefix.From)
 		io.WriteString(h, prefix.To)
 		for _, exclude := range prefix.Excludes {
 			io.WriteString(h, exclude)
 		}
+		if len(prefix.Excludes) > 0 {
+			// excludes without a slash used to only match at the root
+			io.WriteString(h, "<excludes:v2")
+		}
+		for _, include := range prefix.Includes {
+			io.WriteString(h, "+"+include)
+		}
+		for _, rename := range prefix.Renames {
+			io.WriteString(h, "<"+rename.From+"@"+rename.Until)
+		}
+		if prefix.FollowRenames {
+			io.WriteString(h, "<renames")
+		}
 	}
 
 	return h.Sum(nil)
 }
 
-func (c *cache) setHead(head *git.Oid) {
-	c.data["head/"+c.branch] = head[0:20]
+func (c *cache) setHead(branch string, head *git.Oid) {
+	c.data["head/"+branch] = head[0:20]
 }
 
-func (c *cache) getHead() *git.Oid {
-	if head, ok := c.data["head"+c.branch]; ok {
+// getHead returns the last split commit of a branch
+//
+// Values read from the database are copied as they are only valid during the
+// transaction (other caches sharing the database can remap it).
+func (c *cache) getHead(branch string) *git.Oid {
+	if head, ok := c.data["head/"+branch]; ok {
 		return git.NewOidFromBytes(head)
 	}
 
 	var oid *git.Oid
 	c.db.View(func(tx *bolt.Tx) error {
-		result := tx.Bucket(c.key).Get([]byte("head/" + c.branch))
+		result := tx.Bucket(c.key).Get([]byte("head/" + branch))
 		if result != nil {
-			c.data["head/"+c.branch] = result
+			c.data["head/"+branch] = append([]byte(nil), result...)
 			oid = git.NewOidFromBytes(result)
 		}
 		return nil
@@ -115,7 +220,7 @@ func (c *cache) get(rev *git.Oid) *git.Oid {
 	c.db.View(func(tx *bolt.Tx) error {
 		result := tx.Bucket(c.key).Get(rev[0:20])
 		if result != nil {
-			c.data[string(rev[0:20])] = result
+			c.data[string(rev[0:20])] = append([]byte(nil), result...)
 			oid = git.NewOidFromBytes(result)
 		}
 		return nil
@@ -127,6 +232,20 @@ func (c *cache) set(rev, newrev *git.Oid) {
 	c.data[string(rev[0:20])] = newrev[0:20]
 }
 
+// setOriginal stores the commit a split commit has been created from
+func (c *cache) setOriginal(newrev, rev *git.Oid) {
+	c.data["split/"+string(newrev[0:20])] = rev[0:20]
+}
+
+// delete removes a mapping
+func (c *cache) delete(rev *git.Oid) error {
+	delete(c.data, string(rev[0:20]))
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.key).Delete(rev[0:20])
+	})
+}
+
 func (c *cache) gets(commits []*git.Oid) []*git.Oid {
 	var oids []*git.Oid
 	c.db.View(func(tx *bolt.Tx) error {
@@ -155,10 +274,12 @@ func (c *cache) flush() error {
 				return err
 			}
 
-			_, err = tx.CreateBucketIfNotExists(c.key)
+			b, err := tx.CreateBucketIfNotExists(c.key)
 			if err != nil {
 				return err
 			}
+
+			return putBucketMeta(b, c.meta)
 		}
 
 		return nil
@@ -1,10 +1,13 @@
 package splitter
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"path"
 	"strings"
 	"sync"
+	"time"
 
 	git "github.com/libgit2/git2go/v34"
 	bolt "go.etcd.io/bbolt"
@@ -15,6 +18,22 @@ type Prefix struct {
 	From     string
 	To       string
 	Excludes []string
+	// Includes restricts the split to the matching paths
+	Includes []string
+
+	// Markers restricts the directories matching a From pattern
+	// to the ones containing one of these files
+	Markers []string
+
+	// Renames lists the former locations of the prefix
+	Renames []*Rename
+	// FollowRenames detects former locations by matching identical trees
+	FollowRenames bool
+}
+
+// moves returns true if the prefix might be at different locations in history
+func (p *Prefix) moves() bool {
+	return len(p.Renames) > 0 || p.FollowRenames
 }
 
 // NewPrefix returns a new prefix, sanitizing the input
@@ -45,6 +64,49 @@ type Config struct {
 	GitVersion string
 	Debug      bool
 	Scratch    bool
+	Push       string
+	PushForce  bool
+	Tags       string
+	TagTarget  string
+	// Conflict is the strategy used when prefixes produce the same paths:
+	// "error" (default), "first" (the first prefix wins), or "last"
+	Conflict string
+	// Rejoin merges the split back into the origin branch like git subtree
+	Rejoin bool
+	// ReadJoins reuses the splits recorded in git subtree trailers
+	ReadJoins bool
+	// Onto is the sha1 of an existing split history to continue
+	Onto string
+	// MessageTemplate rewrites commit messages (text/template syntax)
+	MessageTemplate string
+	// Mailmap applies the .mailmap file of the origin to authors and committers
+	Mailmap bool
+	// MailmapFile applies the given mailmap file instead
+	MailmapFile string
+	// Committer replaces the committer of split commits ("Name <email>")
+	Committer string
+	// EmptyEmail replaces empty emails (nobody@example.com by default)
+	EmptyEmail string
+	// Anonymize replaces emails by a hash of them
+	Anonymize bool
+	// SigningKey signs split commits and tags with the given key (like
+	// user.signingKey), using SignProgram (gpg or ssh-keygen by default)
+	// and SignFormat ("openpgp" by default, or "ssh")
+	SigningKey  string
+	SignProgram string
+	SignFormat  string
+	// CheckpointCommits and CheckpointInterval persist the cache every N
+	// commits and/or every interval during the split (disabled when 0)
+	CheckpointCommits  int
+	CheckpointInterval time.Duration
+	// OnRewrite is what to do when the origin history has been rewritten
+	// since the last split: "walk" (default) splits the whole history again,
+	// reusing the already split commits, "fail" returns a *RewrittenError
+	OnRewrite string
+	// Name identifies the configuration in the mappings (the prefixes by default)
+	Name string
+	// Mappings receives the mappings of the split commits (optional)
+	Mappings MappingWriter
 
 	// for advanced usage only
 	// naming and types subject to change anytime!
@@ -63,25 +125,170 @@ var supportedGitVersions = map[string]int{
 
 // Split splits a configuration
 func Split(config *Config, result *Result) error {
-	state, err := newState(config, result)
+	return SplitContext(context.Background(), config, result)
+}
+
+// SplitContext splits a configuration until the context is done
+//
+// On cancellation, a *CanceledError is returned and the commits split so far
+// are kept in the cache, so that the next split resumes from there.
+func SplitContext(ctx context.Context, config *Config, result *Result) error {
+	state, err := newState(config, result, false)
 	if err != nil {
 		return err
 	}
 	defer state.close()
-	return state.split()
+	return state.split(ctx)
+}
+
+// SplitMany splits several configurations in one traversal of the history
+//
+// All configurations must use the same repository; each one gets its own
+// cache bucket and result.
+func SplitMany(configs []*Config) ([]*Result, error) {
+	return SplitManyContext(context.Background(), configs)
+}
+
+// SplitManyContext is SplitMany until the context is done (see SplitContext)
+func SplitManyContext(ctx context.Context, configs []*Config) (results []*Result, err error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	path := configs[0].Path
+	for _, config := range configs[1:] {
+		if config.Path != path {
+			return nil, fmt.Errorf("all configurations must use the same repository (%s vs %s)", path, config.Path)
+		}
+	}
+
+	repo, err := git.OpenRepository(path)
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Free()
+
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	caches := make(map[string]*cache)
+	defer func() {
+		for _, c := range caches {
+			if err1 := c.save(); err1 != nil && err == nil {
+				err = err1
+			}
+		}
+		if err1 := db.Close(); err1 != nil && err == nil {
+			err = err1
+		}
+	}()
+
+	repoMu := &sync.Mutex{}
+	states := make([]*state, len(configs))
+	defer func() {
+		for _, s := range states {
+			if s != nil && s.odb != nil {
+				s.odb.Free()
+			}
+		}
+	}()
+	results = make([]*Result, len(configs))
+	for i, config := range configs {
+		c := *config
+		c.Repo = repo
+		c.RepoMu = repoMu
+		c.DB = db
+
+		results[i] = &Result{}
+		if states[i], err = newState(&c, results[i], false); err != nil {
+			return nil, err
+		}
+
+		// configurations with the same bucket share their cache
+		if shared, ok := caches[string(states[i].cache.key)]; ok {
+			states[i].cache = shared
+		} else {
+			caches[string(states[i].cache.key)] = states[i].cache
+		}
+	}
+
+	if err = splitAll(ctx, states); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// ConfigError is returned when a configuration is invalid
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
 }
 
 // Validate validates the configuration
 func (config *Config) Validate() error {
-	ok, err := git.ReferenceNameIsValid(config.Origin)
-	if err != nil {
-		return err
+	if isPattern(config.Origin) {
+		// patterns are expanded by Expand()
+		if config.Target != "" && !strings.Contains(config.Target, "{branch}") {
+			return fmt.Errorf("the target must contain the {branch} placeholder when the origin is a pattern")
+		}
+		if config.Push != "" && !strings.Contains(config.Push, "{branch}") {
+			return fmt.Errorf("the push reference must contain the {branch} placeholder when the origin is a pattern")
+		}
+	} else {
+		ok, err := git.ReferenceNameIsValid(config.Origin)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("the origin is not a valid Git reference")
+		}
 	}
-	if !ok {
-		return fmt.Errorf("the origin is not a valid Git reference")
+
+	globs := 0
+	for _, prefix := range config.Prefixes {
+		if isPattern(prefix.From) {
+			globs++
+		}
+
+		for _, rename := range prefix.Renames {
+			rename.From = strings.TrimRight(rename.From, "/")
+			if rename.From == "" {
+				return fmt.Errorf("a former location of %s is empty", prefix.From)
+			}
+			if rename.Until != "" {
+				if _, err := git.NewOid(rename.Until); err != nil {
+					return fmt.Errorf("the former location %s of %s must be bound by a full commit sha1: %s", rename.From, prefix.From, err)
+				}
+			}
+		}
+	}
+	if globs > 1 {
+		return fmt.Errorf("only one prefix can be a pattern")
+	}
+	if globs == 1 {
+		// patterns are expanded by Expand()
+		if config.Target != "" && !strings.Contains(config.Target, "{name}") {
+			return fmt.Errorf("the target must contain the {name} placeholder when a prefix is a pattern")
+		}
+		if config.Push != "" && !strings.Contains(config.Push, "{name}") {
+			return fmt.Errorf("the push reference must contain the {name} placeholder when a prefix is a pattern")
+		}
+		if config.Tags != "" && !strings.Contains(config.TagTarget, "{name}") {
+			return fmt.Errorf("the tag target must contain the {name} placeholder when a prefix is a pattern")
+		}
 	}
 
-	ok, err = git.ReferenceNameIsValid(config.Target)
+	ok, err := git.ReferenceNameIsValid(config.Target)
 	if err != nil {
 		return err
 	}
@@ -89,6 +296,75 @@ func (config *Config) Validate() error {
 		return fmt.Errorf("the target is not a valid Git reference")
 	}
 
+	if config.Push != "" {
+		if _, _, err := parsePush(config.Push); err != nil {
+			return err
+		}
+	}
+
+	if config.Tags != "" {
+		if _, err := path.Match(config.Tags, ""); err != nil {
+			return fmt.Errorf("the tags pattern is not valid: %s", err)
+		}
+		if !strings.Contains(config.TagTarget, "{tag}") {
+			return fmt.Errorf("the tag target must contain the {tag} placeholder")
+		}
+		ok, err := git.ReferenceNameIsValid(strings.Replace(config.TagTarget, "{tag}", "tag", -1))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("the tag target is not a valid Git reference")
+		}
+	}
+
+	if config.Rejoin || config.ReadJoins {
+		if len(config.Prefixes) != 1 || config.Prefixes[0].To != "" {
+			return fmt.Errorf("rejoining and reading joins are only supported with one prefix split at the root")
+		}
+	}
+
+	if config.Onto != "" {
+		if _, err := git.NewOid(config.Onto); err != nil {
+			return fmt.Errorf("the onto commit must be a full sha1: %s", err)
+		}
+	}
+
+	if config.MessageTemplate != "" {
+		if _, err := newMessageTemplate(config.MessageTemplate); err != nil {
+			return fmt.Errorf("the message template is not valid: %s", err)
+		}
+	}
+
+	if config.Committer != "" {
+		if _, _, err := parseIdentity(config.Committer); err != nil {
+			return err
+		}
+	}
+
+	if config.OnRewrite != "" && config.OnRewrite != "walk" && config.OnRewrite != "fail" {
+		return fmt.Errorf(`the rewrite policy can only be one of "walk" or "fail"`)
+	}
+
+	if _, ok := supportedSignFormats[config.SignFormat]; !ok {
+		return fmt.Errorf(`the signature format can only be one of "openpgp" or "ssh"`)
+	}
+
+	if !supportedConflicts[config.Conflict] {
+		return fmt.Errorf(`the conflict strategy can only be one of "error", "first", or "last"`)
+	}
+
+	// prefixes can only share a directory when their conflicts are resolved
+	if config.Conflict == "" || config.Conflict == "error" {
+		for i, prefix := range config.Prefixes {
+			for _, other := range config.Prefixes[:i] {
+				if other.To == prefix.To {
+					return fmt.Errorf("cannot have two prefix splits under the same directory: %s -> %s vs %s -> %s (use a conflict strategy to merge them)", other.From, other.To, prefix.From, prefix.To)
+				}
+			}
+		}
+	}
+
 	git, ok := supportedGitVersions[config.GitVersion]
 	if !ok {
 		return fmt.Errorf(`the git version can only be one of "<1.8.2", "<2.8.0", or "latest"`)
@@ -0,0 +1,85 @@
+package splitter
+
+import (
+	"fmt"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+var supportedConflicts = map[string]bool{
+	"":      true,
+	"error": true,
+	"first": true,
+	"last":  true,
+}
+
+// ConflictError is returned when two prefixes produce the same paths
+type ConflictError struct {
+	Paths  []string
+	First  *Prefix
+	Second *Prefix
+	// Commit is the origin commit being split
+	Commit *git.Oid
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("cannot split %s as there is a merge conflict between prefixes %s and %s: %s", e.Commit, e.First.From, e.Second.From, strings.Join(e.Paths, ", "))
+}
+
+// resolveConflicts keeps the entries of one side of the conflicts
+// and returns the conflicting paths
+func resolveConflicts(index *git.Index, strategy string) ([]string, error) {
+	iter, err := index.ConflictIterator()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Free()
+
+	var conflicts []git.IndexConflict
+	for {
+		conflict, err := iter.Next()
+		if err != nil {
+			if git.IsErrorCode(err, git.ErrorCodeIterOver) {
+				break
+			}
+			return nil, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	var paths []string
+	for _, conflict := range conflicts {
+		entry := conflict.Our
+		if entry == nil {
+			entry = conflict.Their
+		}
+		paths = append(paths, entry.Path)
+
+		if strategy != "first" && strategy != "last" {
+			continue
+		}
+
+		kept := conflict.Our
+		if strategy == "last" {
+			kept = conflict.Their
+		}
+
+		if err := index.RemoveConflict(entry.Path); err != nil {
+			return nil, err
+		}
+		if kept == nil {
+			// the kept side is a directory, its entries are already in the index
+			continue
+		}
+		// the other side might be a directory
+		if err := index.RemoveDirectory(kept.Path, 0); err != nil {
+			return nil, err
+		}
+		if err := index.Add(kept); err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
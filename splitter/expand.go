@@ -0,0 +1,246 @@
+package splitter
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// isPattern returns true if the value contains glob characters
+func isPattern(value string) bool {
+	return strings.ContainsAny(value, "*?[")
+}
+
+// patternName returns a name without the literal directory part of the pattern
+func patternName(pattern, name string) string {
+	i := strings.LastIndex(pattern, "/")
+	if i < 0 || isPattern(pattern[:i]) {
+		return name
+	}
+	return strings.TrimPrefix(name, pattern[:i+1])
+}
+
+// globPrefix returns the prefix using a pattern if any
+func (config *Config) globPrefix() *Prefix {
+	for _, prefix := range config.Prefixes {
+		if isPattern(prefix.From) {
+			return prefix
+		}
+	}
+	return nil
+}
+
+// Expand returns the configurations to split for a configuration
+//
+// When the origin is a pattern (like refs/heads/*), one configuration is
+// returned per matching reference, with the {branch} placeholder of the
+// target and of the push reference replaced by the reference name minus the
+// literal directory part of the pattern.
+//
+// When a prefix is a pattern (like src/Component/*), one configuration is
+// returned per matching directory of the origin tree (optionally only the
+// ones containing one of the prefix markers), with the {name} placeholder of
+// the prefix destination, the target, the tag target, and the push reference
+// replaced by the directory matched by the last wildcard.
+func Expand(config *Config) ([]*Config, error) {
+	if !isPattern(config.Origin) && config.globPrefix() == nil {
+		return []*Config{config}, nil
+	}
+
+	repo := config.Repo
+	if repo == nil {
+		var err error
+		if repo, err = git.OpenRepository(config.Path); err != nil {
+			return nil, err
+		}
+		defer repo.Free()
+	}
+
+	configs, err := expandOrigin(repo, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.globPrefix() == nil {
+		return configs, nil
+	}
+
+	var expanded []*Config
+	for _, c := range configs {
+		prefixConfigs, err := expandPrefix(repo, c)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, prefixConfigs...)
+	}
+
+	if len(expanded) == 0 {
+		return nil, fmt.Errorf("no directories match the prefix %s", config.globPrefix().From)
+	}
+
+	return expanded, nil
+}
+
+func expandOrigin(repo *git.Repository, config *Config) ([]*Config, error) {
+	if !isPattern(config.Origin) {
+		return []*Config{config}, nil
+	}
+
+	pattern := config.Origin
+	if !strings.HasPrefix(pattern, "refs/") {
+		pattern = "refs/" + pattern
+	}
+
+	iter, err := repo.NewReferenceIteratorGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Free()
+
+	var names []string
+	nameIter := iter.Names()
+	for {
+		name, err := nameIter.Next()
+		if err != nil {
+			if git.IsErrorCode(err, git.ErrorCodeIterOver) {
+				break
+			}
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no references match the origin %s", config.Origin)
+	}
+	sort.Strings(names)
+
+	configs := make([]*Config, len(names))
+	for i, name := range names {
+		branch := patternName(pattern, name)
+		c := *config
+		c.Origin = name
+		c.Target = strings.Replace(config.Target, "{branch}", branch, -1)
+		c.Push = strings.Replace(config.Push, "{branch}", branch, -1)
+		configs[i] = &c
+	}
+
+	return configs, nil
+}
+
+func expandPrefix(repo *git.Repository, config *Config) ([]*Config, error) {
+	glob := config.globPrefix()
+
+	origin, err := normalizeOrigin(repo, config.Origin)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := repo.RevparseSingle(origin)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Free()
+
+	treeObj, err := obj.Peel(git.ObjectTree)
+	if err != nil {
+		return nil, err
+	}
+	defer treeObj.Free()
+
+	tree, err := treeObj.AsTree()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := matchDirectories(repo, tree, strings.Split(glob.From, "/"), "", "", glob.Markers)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []*Config
+	for _, m := range matches {
+		c := *config
+		c.Prefixes = make([]*Prefix, len(config.Prefixes))
+		for i, prefix := range config.Prefixes {
+			if prefix != glob {
+				c.Prefixes[i] = prefix
+				continue
+			}
+			p := *prefix
+			p.From = m.path
+			p.To = strings.Replace(prefix.To, "{name}", m.name, -1)
+			c.Prefixes[i] = &p
+		}
+		c.Target = strings.Replace(config.Target, "{name}", m.name, -1)
+		c.TagTarget = strings.Replace(config.TagTarget, "{name}", m.name, -1)
+		c.Push = strings.Replace(config.Push, "{name}", m.name, -1)
+		configs = append(configs, &c)
+	}
+
+	return configs, nil
+}
+
+type directoryMatch struct {
+	path string
+	name string
+}
+
+// matchDirectories returns the directories of a tree matching the pattern segments
+func matchDirectories(repo *git.Repository, tree *git.Tree, segments []string, base, name string, markers []string) ([]directoryMatch, error) {
+	var matches []directoryMatch
+	for i := uint64(0); i < tree.EntryCount(); i++ {
+		entry := tree.EntryByIndex(i)
+		if entry.Type != git.ObjectTree {
+			continue
+		}
+
+		if ok, _ := path.Match(segments[0], entry.Name); !ok {
+			continue
+		}
+
+		entryName := name
+		if isPattern(segments[0]) {
+			entryName = entry.Name
+		}
+
+		subtree, err := repo.LookupTree(entry.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(segments) > 1 {
+			subMatches, err := matchDirectories(repo, subtree, segments[1:], path.Join(base, entry.Name), entryName, markers)
+			subtree.Free()
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, subMatches...)
+			continue
+		}
+
+		if hasMarker(subtree, markers) {
+			matches = append(matches, directoryMatch{path: path.Join(base, entry.Name), name: entryName})
+		}
+		subtree.Free()
+	}
+
+	return matches, nil
+}
+
+func hasMarker(tree *git.Tree, markers []string) bool {
+	if len(markers) == 0 {
+		return true
+	}
+
+	for _, marker := range markers {
+		if tree.EntryByName(marker) != nil {
+			return true
+		}
+	}
+
+	return false
+}
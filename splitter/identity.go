@@ -0,0 +1,178 @@
+package splitter
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+var identityFormat = regexp.MustCompile(`^\s*([^<]*?)\s*<([^>]*)>\s*$`)
+
+// mailmap maps identities like git mailmap
+type mailmap struct {
+	// entries by lowercased commit email, the ones with a commit name first
+	entries map[string][]*mailmapEntry
+}
+
+type mailmapEntry struct {
+	name        string
+	email       string
+	commitName  string
+	commitEmail string
+}
+
+// parseMailmap parses a .mailmap file
+func parseMailmap(r io.Reader) (*mailmap, error) {
+	m := &mailmap{entries: make(map[string][]*mailmapEntry)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		// Name <email> [Name] [<email>]
+		var names, emails []string
+		for {
+			start := strings.Index(line, "<")
+			end := strings.Index(line, ">")
+			if start < 0 || end < start {
+				break
+			}
+			names = append(names, strings.TrimSpace(line[:start]))
+			emails = append(emails, line[start+1:end])
+			line = line[end+1:]
+		}
+
+		entry := &mailmapEntry{}
+		switch len(emails) {
+		case 0:
+			continue
+		case 1:
+			entry.name, entry.commitEmail = names[0], emails[0]
+		default:
+			entry.name, entry.email = names[0], emails[0]
+			entry.commitName, entry.commitEmail = names[1], emails[1]
+		}
+
+		key := strings.ToLower(entry.commitEmail)
+		if entry.commitName != "" {
+			m.entries[key] = append([]*mailmapEntry{entry}, m.entries[key]...)
+		} else {
+			m.entries[key] = append(m.entries[key], entry)
+		}
+	}
+
+	return m, scanner.Err()
+}
+
+// resolve returns the real name and email of an identity
+func (m *mailmap) resolve(name, email string) (string, string) {
+	for _, entry := range m.entries[strings.ToLower(email)] {
+		if entry.commitName != "" && !strings.EqualFold(entry.commitName, name) {
+			continue
+		}
+		if entry.name != "" {
+			name = entry.name
+		}
+		if entry.email != "" {
+			email = entry.email
+		}
+		break
+	}
+	return name, email
+}
+
+// parseIdentity parses a "Name <email>" identity
+func parseIdentity(value string) (string, string, error) {
+	matches := identityFormat.FindStringSubmatch(value)
+	if matches == nil || matches[1] == "" {
+		return "", "", fmt.Errorf(`the identity "%s" must be formatted as "Name <email>"`, value)
+	}
+	return matches[1], matches[2], nil
+}
+
+// anonymizeEmail replaces an email by a hash of it
+func anonymizeEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return fmt.Sprintf("%x@anonymous.invalid", sum[:8])
+}
+
+// readMailmap reads the mailmap file, or the .mailmap file of the origin
+func (s *state) readMailmap() error {
+	if s.config.MailmapFile != "" {
+		file, err := os.Open(s.config.MailmapFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		s.mailmap, err = parseMailmap(file)
+		return err
+	}
+
+	tip, err := s.repo.LookupCommit(s.tip)
+	if err != nil {
+		return err
+	}
+	defer tip.Free()
+
+	tree, err := tip.Tree()
+	if err != nil {
+		return err
+	}
+	defer tree.Free()
+
+	entry, err := tree.EntryByPath(".mailmap")
+	if err != nil {
+		// no mailmap
+		s.mailmap = &mailmap{}
+		return nil
+	}
+
+	blob, err := s.repo.LookupBlob(entry.Id)
+	if err != nil {
+		return err
+	}
+	defer blob.Free()
+
+	s.mailmap, err = parseMailmap(strings.NewReader(string(blob.Contents())))
+	return err
+}
+
+// rewriteIdentity applies the identity settings to an author or a committer
+func (s *state) rewriteIdentity(sig *git.Signature) *git.Signature {
+	if s.mailmap != nil {
+		sig.Name, sig.Email = s.mailmap.resolve(sig.Name, sig.Email)
+	}
+
+	if sig.Email == "" {
+		sig.Email = s.config.EmptyEmail
+		if sig.Email == "" {
+			sig.Email = "nobody@example.com"
+		}
+	}
+
+	if s.config.Anonymize {
+		sig.Email = anonymizeEmail(sig.Email)
+	}
+
+	return sig
+}
+
+// rewriteCommitter returns the committer of a split commit
+func (s *state) rewriteCommitter(sig *git.Signature) *git.Signature {
+	if s.config.Committer == "" {
+		return s.rewriteIdentity(sig)
+	}
+
+	// the original date is kept to generate the same sha1s on each split
+	name, email, _ := parseIdentity(s.config.Committer)
+	return &git.Signature{Name: name, Email: email, When: sig.When}
+}
@@ -0,0 +1,113 @@
+package splitter
+
+import (
+	"encoding/hex"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// keepRef returns the hidden reference protecting the split commits from
+// being pruned by git gc when there is no target
+func (s *state) keepRef() string {
+	return "refs/splitsh/" + hex.EncodeToString(s.cache.key) + "/" + strings.TrimPrefix(s.origin, "refs/")
+}
+
+func (s *state) updateKeepRef() error {
+	if s.config.Target != "" || s.result.Head() == nil {
+		return nil
+	}
+
+	ref, err := s.repo.References.Create(s.keepRef(), s.result.Head(), true, "subtree split")
+	if err != nil {
+		return err
+	}
+	ref.Free()
+
+	return nil
+}
+
+// deleteKeepRefs removes the hidden references of a cache bucket, for all origins
+func deleteKeepRefs(repo *git.Repository, key string) error {
+	iter, err := repo.NewReferenceIterator()
+	if err != nil {
+		return err
+	}
+	defer iter.Free()
+
+	prefix := "refs/splitsh/" + key + "/"
+	for {
+		ref, err := iter.Next()
+		if err != nil {
+			if git.IsErrorCode(err, git.ErrorCodeIterOver) {
+				return nil
+			}
+			return err
+		}
+
+		if strings.HasPrefix(ref.Name(), prefix) {
+			err = ref.Delete()
+		}
+		ref.Free()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// exists returns false when an object has been pruned from the repository
+func (s *state) exists(oid *git.Oid) bool {
+	if s.odb == nil {
+		odb, err := s.repo.Odb()
+		if err != nil {
+			return true
+		}
+		s.odb = odb
+	}
+
+	return s.odb.Exists(oid)
+}
+
+// splitParents returns the split parents, splitting again the ones
+// mapped to pruned commits
+func (s *state) splitParents(parents []*git.Oid) ([]*git.Oid, error) {
+	newParents := s.cache.gets(parents)
+
+	dangling := false
+	for _, parent := range newParents {
+		if !s.exists(parent) {
+			dangling = true
+			break
+		}
+	}
+	if !dangling {
+		return newParents, nil
+	}
+
+	newParents = nil
+	for _, parent := range parents {
+		newParent := s.cache.get(parent)
+		if newParent == nil {
+			continue
+		}
+
+		if !s.exists(newParent) {
+			commit, err := s.repo.LookupCommit(parent)
+			if err != nil {
+				return nil, err
+			}
+			newParent, err = s.splitRev(commit)
+			commit.Free()
+			if err != nil {
+				return nil, err
+			}
+			if newParent == nil {
+				continue
+			}
+		}
+
+		newParents = append(newParents, newParent)
+	}
+
+	return newParents, nil
+}
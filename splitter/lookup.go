@@ -0,0 +1,75 @@
+package splitter
+
+import (
+	"bytes"
+	"fmt"
+
+	git "github.com/libgit2/git2go/v34"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Mapping is an original commit and its split commit
+type Mapping struct {
+	Original *git.Oid
+	Split    *git.Oid
+	// Status is how the mapping has been obtained during a split
+	// (MappingCreated, MappingReused, or MappingSkipped), empty otherwise
+	Status string
+	// Name is the name of the configuration
+	Name string
+}
+
+// Lookup finds the mappings of a configuration by original or by split commit
+//
+// When looking up a split commit, the original commit it has been created
+// from is returned; for caches populated by older versions, all the original
+// commits mapped to the split commit are returned instead.
+func Lookup(config *Config, original, split *git.Oid) ([]*Mapping, error) {
+	if (original == nil) == (split == nil) {
+		return nil, fmt.Errorf("either an original or a split commit must be given")
+	}
+
+	c := *config
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	db := c.DB
+	if db == nil {
+		var err error
+		if db, err = openDB(c.Path); err != nil {
+			return nil, err
+		}
+		defer db.Close()
+	}
+
+	var mappings []*Mapping
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key(&c))
+		if b == nil {
+			return fmt.Errorf("no cache for this configuration")
+		}
+
+		if original != nil {
+			if v := b.Get(original[0:20]); v != nil {
+				mappings = append(mappings, &Mapping{Original: original, Split: git.NewOidFromBytes(v)})
+			}
+			return nil
+		}
+
+		if v := b.Get(append([]byte("split/"), split[0:20]...)); v != nil {
+			mappings = append(mappings, &Mapping{Original: git.NewOidFromBytes(v), Split: split})
+			return nil
+		}
+
+		// no reverse index
+		return b.ForEach(func(k, v []byte) error {
+			if isMappingKey(k) && bytes.Equal(v, split[0:20]) {
+				mappings = append(mappings, &Mapping{Original: git.NewOidFromBytes(k), Split: split})
+			}
+			return nil
+		})
+	})
+
+	return mappings, err
+}
@@ -0,0 +1,180 @@
+package splitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest represents a set of named splits
+type Manifest struct {
+	Splits []*ManifestSplit
+}
+
+// ManifestSplit represents a named split configuration
+type ManifestSplit struct {
+	Name   string
+	Config *Config
+}
+
+type manifestFile struct {
+	Origin string           `json:"origin" yaml:"origin"`
+	Git    string           `json:"git" yaml:"git"`
+	Splits []*manifestEntry `json:"splits" yaml:"splits"`
+}
+
+type manifestEntry struct {
+	Name        string            `json:"name" yaml:"name"`
+	Prefixes    []*manifestPrefix `json:"prefixes" yaml:"prefixes"`
+	Origin      string            `json:"origin" yaml:"origin"`
+	Target      string            `json:"target" yaml:"target"`
+	Commit      string            `json:"commit" yaml:"commit"`
+	Git         string            `json:"git" yaml:"git"`
+	Push        string            `json:"push" yaml:"push"`
+	PushForce   bool              `json:"push-force" yaml:"push-force"`
+	Tags        string            `json:"tags" yaml:"tags"`
+	TagTarget   string            `json:"tag-target" yaml:"tag-target"`
+	Conflict    string            `json:"conflict" yaml:"conflict"`
+	Rejoin      bool              `json:"rejoin" yaml:"rejoin"`
+	ReadJoins   bool              `json:"read-joins" yaml:"read-joins"`
+	Onto        string            `json:"onto" yaml:"onto"`
+	Message     string            `json:"message" yaml:"message"`
+	Mailmap     bool              `json:"mailmap" yaml:"mailmap"`
+	MailmapFile string            `json:"mailmap-file" yaml:"mailmap-file"`
+	Committer   string            `json:"committer" yaml:"committer"`
+	EmptyEmail  string            `json:"empty-email" yaml:"empty-email"`
+	Anonymize   bool              `json:"anonymize" yaml:"anonymize"`
+	SigningKey  string            `json:"signing-key" yaml:"signing-key"`
+	SignProgram string            `json:"sign-program" yaml:"sign-program"`
+	SignFormat  string            `json:"sign-format" yaml:"sign-format"`
+}
+
+type manifestPrefix struct {
+	From          string    `json:"from" yaml:"from"`
+	To            string    `json:"to" yaml:"to"`
+	Excludes      []string  `json:"excludes" yaml:"excludes"`
+	Includes      []string  `json:"includes" yaml:"includes"`
+	Markers       []string  `json:"markers" yaml:"markers"`
+	Renames       []*Rename `json:"renames" yaml:"renames"`
+	FollowRenames bool      `json:"follow-renames" yaml:"follow-renames"`
+}
+
+// LoadManifest loads and validates a manifest file (YAML or JSON)
+func LoadManifest(file string) (*Manifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// unknown keys are rejected, a typo must not silently change a split
+	var m manifestFile
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&m)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&m)
+	}
+	if err == io.EOF {
+		// empty file, reported below
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse manifest %s: %s", file, err)
+	}
+
+	if len(m.Splits) == 0 {
+		return nil, fmt.Errorf("manifest %s does not define any split", file)
+	}
+
+	manifest := &Manifest{}
+	names := make(map[string]bool)
+	for i, entry := range m.Splits {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("split #%d has no name", i+1)
+		}
+		if names[entry.Name] {
+			return nil, fmt.Errorf("split %s is defined more than once", entry.Name)
+		}
+		names[entry.Name] = true
+
+		config, err := entry.config(&m)
+		if err != nil {
+			return nil, fmt.Errorf("split %s: %s", entry.Name, err)
+		}
+
+		manifest.Splits = append(manifest.Splits, &ManifestSplit{Name: entry.Name, Config: config})
+	}
+
+	return manifest, nil
+}
+
+func (e *manifestEntry) config(m *manifestFile) (*Config, error) {
+	if len(e.Prefixes) == 0 {
+		return nil, fmt.Errorf("at least one prefix is required")
+	}
+
+	config := &Config{
+		Origin:          e.Origin,
+		Target:          e.Target,
+		Commit:          e.Commit,
+		GitVersion:      e.Git,
+		Push:            e.Push,
+		PushForce:       e.PushForce,
+		Tags:            e.Tags,
+		TagTarget:       e.TagTarget,
+		Conflict:        e.Conflict,
+		Rejoin:          e.Rejoin,
+		ReadJoins:       e.ReadJoins,
+		Onto:            e.Onto,
+		MessageTemplate: e.Message,
+		Mailmap:         e.Mailmap,
+		MailmapFile:     e.MailmapFile,
+		Committer:       e.Committer,
+		EmptyEmail:      e.EmptyEmail,
+		Anonymize:       e.Anonymize,
+		SigningKey:      e.SigningKey,
+		SignProgram:     e.SignProgram,
+		SignFormat:      e.SignFormat,
+	}
+	if config.Origin == "" {
+		config.Origin = m.Origin
+	}
+	if config.Origin == "" {
+		config.Origin = "HEAD"
+	}
+	if config.GitVersion == "" {
+		config.GitVersion = m.Git
+	}
+	if config.GitVersion == "" {
+		config.GitVersion = "latest"
+	}
+
+	for _, p := range e.Prefixes {
+		if p.From == "" {
+			return nil, fmt.Errorf("a prefix must have a from path")
+		}
+		prefix := NewPrefix(p.From, p.To, p.Excludes)
+		prefix.Markers = p.Markers
+		prefix.FollowRenames = p.FollowRenames
+		prefix.Renames = p.Renames
+		for _, include := range p.Includes {
+			prefix.Includes = append(prefix.Includes, strings.TrimRight(include, "/"))
+		}
+		config.Prefixes = append(config.Prefixes, prefix)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
@@ -0,0 +1,151 @@
+package splitter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+	bolt "go.etcd.io/bbolt"
+)
+
+// mapping statuses
+const (
+	// MappingCreated is a split commit created for the original commit
+	MappingCreated = "created"
+	// MappingReused is a mapping found in the cache
+	MappingReused = "reused"
+	// MappingSkipped is an original commit mapped to the split commit of a parent
+	MappingSkipped = "skipped"
+)
+
+// MappingWriter receives the mappings of splits
+type MappingWriter interface {
+	Write(mapping *Mapping) error
+	Flush() error
+}
+
+type jsonMappingWriter struct {
+	encoder *json.Encoder
+}
+
+// NewJSONMappingWriter returns a writer of mappings as JSON lines
+func NewJSONMappingWriter(w io.Writer) MappingWriter {
+	return &jsonMappingWriter{encoder: json.NewEncoder(w)}
+}
+
+func (w *jsonMappingWriter) Write(mapping *Mapping) error {
+	return w.encoder.Encode(struct {
+		Original string `json:"original"`
+		Split    string `json:"split"`
+		Status   string `json:"status,omitempty"`
+		Name     string `json:"name,omitempty"`
+	}{mapping.Original.String(), mapping.Split.String(), mapping.Status, mapping.Name})
+}
+
+func (w *jsonMappingWriter) Flush() error {
+	return nil
+}
+
+type csvMappingWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+// NewCSVMappingWriter returns a writer of mappings as CSV (with a header)
+func NewCSVMappingWriter(w io.Writer) MappingWriter {
+	return &csvMappingWriter{writer: csv.NewWriter(w)}
+}
+
+func (w *csvMappingWriter) Write(mapping *Mapping) error {
+	if !w.header {
+		if err := w.writer.Write([]string{"original", "split", "status", "name"}); err != nil {
+			return err
+		}
+		w.header = true
+	}
+
+	return w.writer.Write([]string{mapping.Original.String(), mapping.Split.String(), mapping.Status, mapping.Name})
+}
+
+func (w *csvMappingWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// configName returns the name of a configuration, its prefixes by default
+func configName(config *Config) string {
+	if config.Name != "" {
+		return config.Name
+	}
+
+	var prefixes []string
+	for _, prefix := range config.Prefixes {
+		prefixes = append(prefixes, formatPrefix(prefix))
+	}
+	return strings.Join(prefixes, " ")
+}
+
+// writeMapping sends a mapping to the configured writer if any
+func (s *state) writeMapping(rev, newrev *git.Oid, status string) error {
+	if s.config.Mappings == nil {
+		return nil
+	}
+
+	if err := s.config.Mappings.Write(&Mapping{Original: rev, Split: newrev, Status: status, Name: configName(s.config)}); err != nil {
+		return fmt.Errorf("unable to write the mapping of %s: %s", rev, err)
+	}
+
+	return nil
+}
+
+// flushMappings flushes the configured writer if any
+func (s *state) flushMappings() error {
+	if s.config.Mappings == nil {
+		return nil
+	}
+
+	if err := s.config.Mappings.Flush(); err != nil {
+		return fmt.Errorf("unable to write the mappings: %s", err)
+	}
+
+	return nil
+}
+
+// Export writes all the cached mappings of a configuration
+func Export(config *Config, w MappingWriter) error {
+	c := *config
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	db := c.DB
+	if db == nil {
+		var err error
+		if db, err = openDB(c.Path); err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key(&c))
+		if b == nil {
+			return fmt.Errorf("no cache for this configuration")
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if !isMappingKey(k) {
+				return nil
+			}
+			return w.Write(&Mapping{Original: git.NewOidFromBytes(k), Split: git.NewOidFromBytes(v), Name: configName(&c)})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
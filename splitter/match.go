@@ -0,0 +1,110 @@
+package splitter
+
+import (
+	"path"
+	"strings"
+)
+
+// pattern is a gitignore-like pattern, relative to the root of the prefix
+type pattern struct {
+	segments []string
+	negate   bool
+}
+
+// matcher matches paths against a list of patterns, the last matching one wins
+type matcher struct {
+	patterns []*pattern
+}
+
+// newMatcher returns a matcher for the patterns
+//
+// Unless anchored is true, patterns without a slash (except a trailing one)
+// match at any depth, like in gitignore files; a leading slash anchors them.
+func newMatcher(patterns []string, anchored bool) *matcher {
+	m := &matcher{}
+	for _, p := range patterns {
+		negate := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		floating := !anchored && !strings.Contains(strings.TrimRight(p, "/"), "/")
+		p = strings.Trim(p, "/")
+		if p == "" {
+			continue
+		}
+		segments := strings.Split(p, "/")
+		if floating {
+			segments = append([]string{"**"}, segments...)
+		}
+		m.patterns = append(m.patterns, &pattern{segments: segments, negate: negate})
+	}
+	return m
+}
+
+// match returns whether a pattern matches the path, and if the last one is not a negation
+func (m *matcher) match(p string) (bool, bool) {
+	segments := strings.Split(p, "/")
+	matched, positive := false, false
+	for _, pattern := range m.patterns {
+		if matchSegments(pattern.segments, segments) {
+			matched, positive = true, !pattern.negate
+		}
+	}
+	return matched, positive
+}
+
+// mayMatchBelow returns true if a pattern could match a path inside the directory
+func (m *matcher) mayMatchBelow(dir string) bool {
+	segments := strings.Split(dir, "/")
+	for _, pattern := range m.patterns {
+		if matchPrefixSegments(pattern.segments, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments, ** matching zero or more segments
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// matchPrefixSegments returns true if the pattern could match a path starting with the directory segments
+func matchPrefixSegments(pattern, dir []string) bool {
+	if len(dir) == 0 {
+		return len(pattern) > 0
+	}
+
+	if len(pattern) == 0 {
+		return false
+	}
+
+	if pattern[0] == "**" {
+		return true
+	}
+
+	if ok, _ := path.Match(pattern[0], dir[0]); !ok {
+		return false
+	}
+
+	return matchPrefixSegments(pattern[1:], dir[1:])
+}
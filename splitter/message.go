@@ -0,0 +1,91 @@
+package splitter
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+var trailerLine = regexp.MustCompile(`^[A-Za-z0-9-]+: `)
+
+// messageData is what message templates have access to
+type messageData struct {
+	// Message is the original message (as used when there is no template)
+	Message  string
+	Subject  string
+	Body     string
+	Original string
+	// Prefix is the first prefix, Prefixes all of them
+	Prefix   string
+	Prefixes []string
+	Author   *git.Signature
+}
+
+// newMessageTemplate parses a message template
+func newMessageTemplate(text string) (*template.Template, error) {
+	regexps := make(map[string]*regexp.Regexp)
+	funcs := template.FuncMap{
+		// replace replaces the matches of a regular expression
+		"replace": func(pattern, replacement, s string) (string, error) {
+			re, ok := regexps[pattern]
+			if !ok {
+				var err error
+				if re, err = regexp.Compile(pattern); err != nil {
+					return "", err
+				}
+				regexps[pattern] = re
+			}
+			return re.ReplaceAllString(s, replacement), nil
+		},
+		// trailer appends a trailer to a message
+		"trailer": appendTrailer,
+	}
+
+	return template.New("message").Funcs(funcs).Parse(text)
+}
+
+// appendTrailer adds a trailer to the trailers block of a message
+func appendTrailer(key, value, message string) string {
+	message = strings.TrimRight(message, "\r\n")
+	paragraphs := strings.Split(message, "\n\n")
+	last := paragraphs[len(paragraphs)-1]
+
+	isTrailers := len(paragraphs) > 1
+	for _, line := range strings.Split(last, "\n") {
+		if !trailerLine.MatchString(line) {
+			isTrailers = false
+			break
+		}
+	}
+
+	if isTrailers {
+		return message + "\n" + key + ": " + value + "\n"
+	}
+	return message + "\n\n" + key + ": " + value + "\n"
+}
+
+// rewriteMessage applies the message template to a commit message
+func (s *state) rewriteMessage(rev *git.Commit, message string) (string, error) {
+	subject, body := SplitMessage(rev.Message())
+	data := &messageData{
+		Message:  message,
+		Subject:  subject,
+		Body:     body,
+		Original: rev.Id().String(),
+		Author:   rev.Author(),
+	}
+	for _, prefix := range s.config.Prefixes {
+		data.Prefixes = append(data.Prefixes, prefix.From)
+	}
+	data.Prefix = data.Prefixes[0]
+
+	var buf bytes.Buffer
+	if err := s.message.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
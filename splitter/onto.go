@@ -0,0 +1,97 @@
+package splitter
+
+import (
+	"context"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// ontoEntry is a commit of the existing split history
+type ontoEntry struct {
+	id      *git.Oid
+	parents []*git.Oid
+}
+
+// readOnto indexes the commits of the existing split history by tree
+//
+// Commits are stored from the oldest to the newest, as the split history.
+func (s *state) readOnto(ctx context.Context) error {
+	onto, err := git.NewOid(s.config.Onto)
+	if err != nil {
+		return err
+	}
+
+	revWalk, err := s.repo.Walk()
+	if err != nil {
+		return err
+	}
+	defer revWalk.Free()
+
+	if err := revWalk.Push(onto); err != nil {
+		return err
+	}
+	revWalk.Sorting(git.SortTopological | git.SortReverse)
+
+	s.onto = make(map[string][]*ontoEntry)
+	var iterationErr error
+	err = revWalk.Iterate(func(commit *git.Commit) bool {
+		defer commit.Free()
+
+		if err := canceled(ctx); err != nil {
+			iterationErr = err
+			return false
+		}
+
+		entry := &ontoEntry{id: commit.Id()}
+		for n := uint(0); n < commit.ParentCount(); n++ {
+			entry.parents = append(entry.parents, commit.ParentId(n))
+		}
+
+		tree := string(commit.TreeId()[0:20])
+		s.onto[tree] = append(s.onto[tree], entry)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	return iterationErr
+}
+
+// ontoCommit returns the next unused commit of the existing split history
+// with the given tree and parents
+//
+// Parents must match, otherwise a commit reverting to an already published
+// tree would be mapped to an old commit, dropping the history after it.
+func (s *state) ontoCommit(tree *git.Oid, parents []*git.Oid) *git.Oid {
+	commits := s.onto[string(tree[0:20])]
+	for i, entry := range commits {
+		if !sameOids(entry.parents, parents) {
+			continue
+		}
+
+		s.onto[string(tree[0:20])] = append(commits[:i:i], commits[i+1:]...)
+		return entry.id
+	}
+
+	return nil
+}
+
+// sameOids returns true when both lists contain the same sha1s
+func sameOids(a, b []*git.Oid) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	set := make(map[string]bool)
+	for _, oid := range a {
+		set[string(oid[0:20])] = true
+	}
+	for _, oid := range b {
+		if !set[string(oid[0:20])] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,197 @@
+package splitter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// PushResult represents the outcome of a push
+type PushResult struct {
+	Remote string
+	Ref    string
+	Old    *git.Oid
+	New    *git.Oid
+}
+
+// parsePush parses a push value formatted as <remote-or-url>:<ref>
+func parsePush(value string) (string, string, error) {
+	// URLs can contain colons, but references cannot
+	i := strings.LastIndex(value, ":")
+	if i <= 0 || i == len(value)-1 {
+		return "", "", fmt.Errorf("the push value must be formatted as <remote-or-url>:<ref>")
+	}
+
+	remote, ref := value[:i], value[i+1:]
+	if !strings.HasPrefix(ref, "refs/") {
+		ref = "refs/heads/" + ref
+	}
+
+	ok, err := git.ReferenceNameIsValid(ref)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", fmt.Errorf("the push reference is not a valid Git reference")
+	}
+
+	return remote, ref, nil
+}
+
+func (s *state) push(ctx context.Context) error {
+	if s.config.Push == "" {
+		return nil
+	}
+
+	if err := canceled(ctx); err != nil {
+		return err
+	}
+
+	head := s.result.Head()
+	if head == nil {
+		return fmt.Errorf("unable to push to %s as it is empty (no commits were split)", s.config.Push)
+	}
+
+	name, ref, err := parsePush(s.config.Push)
+	if err != nil {
+		return err
+	}
+
+	remote, err := s.repo.Remotes.Lookup(name)
+	if err != nil {
+		// not a configured remote, this must be a URL or a path
+		if remote, err = s.repo.Remotes.CreateAnonymous(name); err != nil {
+			return err
+		}
+	}
+	defer remote.Free()
+
+	callbacks := remoteCallbacks(ctx)
+	if err := remote.ConnectFetch(&callbacks, nil, nil); err != nil {
+		if err := canceled(ctx); err != nil {
+			return err
+		}
+		return fmt.Errorf("unable to connect to %s: %s", name, err)
+	}
+	heads, err := remote.Ls()
+	remote.Disconnect()
+	if err != nil {
+		return err
+	}
+
+	result := &PushResult{Remote: name, Ref: ref, New: head}
+	for _, h := range heads {
+		if h.Name == ref {
+			result.Old = h.Id
+			break
+		}
+	}
+
+	if result.Old != nil && result.Old.Cmp(head) == 0 {
+		if s.config.Debug {
+			s.logger.Printf("%s %s is up to date\n", name, ref)
+		}
+		s.result.setPushed(result)
+		return nil
+	}
+
+	refspec := fmt.Sprintf("%s:%s", head, ref)
+	if s.config.PushForce {
+		refspec = "+" + refspec
+	} else if result.Old != nil {
+		if err := s.checkFastForward(ctx, remote, ref, result.Old, head); err != nil {
+			return err
+		}
+	}
+
+	if s.config.Debug {
+		s.logger.Printf("Pushing %s to %s %s\n", head, name, ref)
+	}
+
+	var rejected error
+	callbacks.PushUpdateReferenceCallback = func(refname, status string) error {
+		if status != "" {
+			rejected = fmt.Errorf("%s rejected the update of %s: %s", name, refname, status)
+		}
+		return nil
+	}
+	if err := remote.Push([]string{refspec}, &git.PushOptions{RemoteCallbacks: callbacks}); err != nil {
+		if err := canceled(ctx); err != nil {
+			return err
+		}
+		return fmt.Errorf("unable to push to %s: %s", name, err)
+	}
+	if rejected != nil {
+		return rejected
+	}
+
+	s.result.setPushed(result)
+
+	return nil
+}
+
+// checkFastForward checks that the remote reference can be fast-forwarded to head
+func (s *state) checkFastForward(ctx context.Context, remote *git.Remote, ref string, old, head *git.Oid) error {
+	odb, err := s.repo.Odb()
+	if err != nil {
+		return err
+	}
+	defer odb.Free()
+
+	if !odb.Exists(old) {
+		// fetch the remote commit to be able to compare histories
+		callbacks := remoteCallbacks(ctx)
+		err := remote.Fetch([]string{ref}, &git.FetchOptions{RemoteCallbacks: callbacks, DownloadTags: git.DownloadTagsNone}, "")
+		if err != nil {
+			if err := canceled(ctx); err != nil {
+				return err
+			}
+			return fmt.Errorf("unable to fetch %s from %s: %s", ref, remote.Url(), err)
+		}
+	}
+
+	ok, err := s.repo.DescendantOf(head, old)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("unable to push to %s as %s is not a fast-forward of %s (force the push to overwrite it)", ref, head, old)
+	}
+
+	return nil
+}
+
+// remoteCallbacks returns the callbacks of remote operations, aborted when the context is done
+func remoteCallbacks(ctx context.Context) git.RemoteCallbacks {
+	attempts := 0
+	return git.RemoteCallbacks{
+		TransferProgressCallback: func(stats git.TransferProgress) error {
+			return ctx.Err()
+		},
+		PushTransferProgressCallback: func(current, total uint32, bytes uint) error {
+			return ctx.Err()
+		},
+		CredentialsCallback: func(url string, username string, allowed git.CredentialType) (*git.Credential, error) {
+			// libgit2 asks again and again when credentials are rejected
+			attempts++
+			if attempts > 3 {
+				return nil, fmt.Errorf("authentication failed for %s", url)
+			}
+
+			if allowed&git.CredentialTypeSSHKey != 0 {
+				if username == "" {
+					username = "git"
+				}
+				return git.NewCredentialSSHKeyFromAgent(username)
+			}
+
+			if allowed&git.CredentialTypeDefault != 0 {
+				return git.NewCredentialDefault()
+			}
+
+			return nil, fmt.Errorf("no supported authentication method for %s", url)
+		},
+	}
+}
@@ -0,0 +1,188 @@
+package splitter
+
+import (
+	"context"
+	"errors"
+	"path"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+var errStopWalk = errors.New("stop")
+
+// Rename represents a former location of a prefix
+type Rename struct {
+	From string `json:"from" yaml:"from"`
+	// Until is the sha1 of the last commit where the prefix was at From
+	// (optional, the location is used for all commits when empty)
+	Until string `json:"until" yaml:"until"`
+}
+
+// prefixPath returns the path of a prefix for a given commit
+func (s *state) prefixPath(tree *git.Tree, prefix *Prefix, commit *git.Oid) string {
+	if locations := s.locations[prefix]; locations != nil {
+		if p, ok := locations[string(commit[0:20])]; ok {
+			return p
+		}
+	}
+
+	if len(prefix.Renames) == 0 || hasPath(tree, prefix.From) {
+		return prefix.From
+	}
+
+	for _, rename := range prefix.Renames {
+		if rename.Until != "" && !s.isAncestor(commit, rename.Until) {
+			continue
+		}
+		if hasPath(tree, rename.From) {
+			return rename.From
+		}
+	}
+
+	return prefix.From
+}
+
+// isAncestor returns true if the commit is the given sha1 or one of its ancestors
+func (s *state) isAncestor(commit *git.Oid, sha1 string) bool {
+	key := sha1 + string(commit[0:20])
+	if ok, found := s.ancestors[key]; found {
+		return ok
+	}
+
+	ok := false
+	if until, err := git.NewOid(sha1); err == nil {
+		ok = until.Cmp(commit) == 0
+		if !ok {
+			ok, _ = s.repo.DescendantOf(until, commit)
+		}
+	}
+	s.ancestors[key] = ok
+
+	return ok
+}
+
+// followRenames finds the former locations of a prefix in the split range
+//
+// History is walked from the newest commits; when a parent does not have the
+// prefix path anymore, the location of the identical tree in the parent is
+// used for the parent and its ancestors.
+func (s *state) followRenames(ctx context.Context, prefix *Prefix) error {
+	revWalk, err := s.repo.Walk()
+	if err != nil {
+		return err
+	}
+	defer revWalk.Free()
+
+	if err := revWalk.Push(s.tip); err != nil {
+		return err
+	}
+	if s.hide != nil {
+		if err := revWalk.Hide(s.hide); err != nil {
+			return err
+		}
+	}
+	revWalk.Sorting(git.SortTopological)
+
+	locations := make(map[string]string)
+	var iterationErr error
+	err = revWalk.Iterate(func(commit *git.Commit) bool {
+		defer commit.Free()
+
+		if err := canceled(ctx); err != nil {
+			iterationErr = err
+			return false
+		}
+
+		p, ok := locations[string(commit.Id()[0:20])]
+		if !ok {
+			p = prefix.From
+			locations[string(commit.Id()[0:20])] = p
+		}
+
+		tree, err := commit.Tree()
+		if err != nil {
+			iterationErr = err
+			return false
+		}
+		defer tree.Free()
+
+		entry, err := tree.EntryByPath(p)
+		if err != nil || entry.Type != git.ObjectTree {
+			entry = nil
+		}
+
+		for n := uint(0); n < commit.ParentCount(); n++ {
+			parentID := commit.ParentId(n)
+			if _, ok := locations[string(parentID[0:20])]; ok {
+				// the location from the first child wins
+				continue
+			}
+
+			location := p
+			if entry != nil {
+				if parent := commit.Parent(n); parent != nil {
+					location, err = s.parentLocation(parent, tree, p, entry.Id)
+					parent.Free()
+					if err != nil {
+						iterationErr = err
+						return false
+					}
+				}
+			}
+			if location != p && s.config.Debug {
+				s.logger.Printf("Prefix %s is at %s in %s\n", prefix.From, location, parentID)
+			}
+			locations[string(parentID[0:20])] = location
+		}
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if iterationErr != nil {
+		return iterationErr
+	}
+
+	s.locations[prefix] = locations
+
+	return nil
+}
+
+// parentLocation returns where a tree is in a parent commit
+//
+// Only paths removed in the child are candidates, a copy is not a rename.
+func (s *state) parentLocation(parent *git.Commit, child *git.Tree, p string, id *git.Oid) (string, error) {
+	tree, err := parent.Tree()
+	if err != nil {
+		return "", err
+	}
+	defer tree.Free()
+
+	if hasPath(tree, p) {
+		return p, nil
+	}
+
+	location := p
+	err = tree.Walk(func(dir string, entry *git.TreeEntry) error {
+		if entry.Type == git.ObjectTree && entry.Id.Cmp(id) == 0 {
+			candidate := path.Join(dir, entry.Name)
+			if _, err := child.EntryByPath(candidate); err == nil {
+				return nil
+			}
+			location = candidate
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil && err != errStopWalk {
+		return "", err
+	}
+
+	return location, nil
+}
+
+func hasPath(tree *git.Tree, p string) bool {
+	entry, err := tree.EntryByPath(p)
+	return err == nil && entry.Type == git.ObjectTree
+}
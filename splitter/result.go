@@ -1,6 +1,7 @@
 package splitter
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
 
@@ -14,6 +15,12 @@ type Result struct {
 	created   int
 	head      *git.Oid
 	duration  time.Duration
+	pushed    *PushResult
+	tags      []string
+	rejoined  *git.Oid
+	target    string
+	oldTarget *git.Oid
+	bucket    string
 }
 
 // NewResult returns a pre-populated result
@@ -53,12 +60,139 @@ func (r *Result) Head() *git.Oid {
 	return r.head
 }
 
+// Pushed returns the outcome of the push (nil when nothing was pushed)
+func (r *Result) Pushed() *PushResult {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pushed
+}
+
+// Tags returns the split tags created or updated
+func (r *Result) Tags() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tags
+}
+
+// Rejoined returns the rejoin commit created on the origin branch if any
+func (r *Result) Rejoined() *git.Oid {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rejoined
+}
+
+// Target returns the updated target reference (empty when there is none)
+func (r *Result) Target() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.target
+}
+
+// OldTarget returns the sha1 of the target before the split (nil when it has been created)
+func (r *Result) OldTarget() *git.Oid {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.oldTarget
+}
+
+// Bucket returns the key of the cache bucket used by the split
+func (r *Result) Bucket() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.bucket
+}
+
+// MarshalJSON encodes the result, with null for missing sha1s and the duration in milliseconds
+func (r *Result) MarshalJSON() ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type pushed struct {
+		Remote string  `json:"remote"`
+		Ref    string  `json:"ref"`
+		Old    *string `json:"old"`
+		New    *string `json:"new"`
+	}
+
+	data := struct {
+		Head      *string  `json:"head"`
+		Target    string   `json:"target,omitempty"`
+		OldTarget *string  `json:"old_target,omitempty"`
+		Created   int      `json:"created"`
+		Traversed int      `json:"traversed"`
+		Duration  int64    `json:"duration_ms"`
+		Bucket    string   `json:"bucket,omitempty"`
+		Tags      []string `json:"tags,omitempty"`
+		Rejoined  *string  `json:"rejoined,omitempty"`
+		Pushed    *pushed  `json:"pushed,omitempty"`
+	}{
+		Head:      oidString(r.head),
+		Target:    r.target,
+		OldTarget: oidString(r.oldTarget),
+		Created:   r.created,
+		Traversed: r.traversed,
+		Duration:  r.duration.Milliseconds(),
+		Bucket:    r.bucket,
+		Tags:      r.tags,
+		Rejoined:  oidString(r.rejoined),
+	}
+	if r.pushed != nil {
+		data.Pushed = &pushed{
+			Remote: r.pushed.Remote,
+			Ref:    r.pushed.Ref,
+			Old:    oidString(r.pushed.Old),
+			New:    oidString(r.pushed.New),
+		}
+	}
+
+	return json.Marshal(data)
+}
+
+func oidString(oid *git.Oid) *string {
+	if oid == nil {
+		return nil
+	}
+	s := oid.String()
+	return &s
+}
+
 func (r *Result) moveHead(oid *git.Oid) {
 	r.mu.Lock()
 	r.head = oid
 	r.mu.Unlock()
 }
 
+func (r *Result) setPushed(pushed *PushResult) {
+	r.mu.Lock()
+	r.pushed = pushed
+	r.mu.Unlock()
+}
+
+func (r *Result) setRejoined(oid *git.Oid) {
+	r.mu.Lock()
+	r.rejoined = oid
+	r.mu.Unlock()
+}
+
+func (r *Result) setTarget(target string, old *git.Oid) {
+	r.mu.Lock()
+	r.target = target
+	r.oldTarget = old
+	r.mu.Unlock()
+}
+
+func (r *Result) setBucket(bucket string) {
+	r.mu.Lock()
+	r.bucket = bucket
+	r.mu.Unlock()
+}
+
+func (r *Result) addTag(tag string) {
+	r.mu.Lock()
+	r.tags = append(r.tags, tag)
+	r.mu.Unlock()
+}
+
 func (r *Result) incCreated() {
 	r.mu.Lock()
 	r.created++
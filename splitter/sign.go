@@ -0,0 +1,64 @@
+package splitter
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+var supportedSignFormats = map[string]string{
+	"":        "gpg",
+	"openpgp": "gpg",
+	"ssh":     "ssh-keygen",
+}
+
+// sign signs a commit or a tag buffer with the configured program
+func (s *state) sign(data string) (string, error) {
+	program := s.config.SignProgram
+	if program == "" {
+		program = supportedSignFormats[s.config.SignFormat]
+	}
+
+	var cmd *exec.Cmd
+	if s.config.SignFormat == "ssh" {
+		cmd = exec.Command(program, "-Y", "sign", "-n", "git", "-f", s.config.SigningKey)
+	} else {
+		cmd = exec.Command(program, "-bsau", s.config.SigningKey)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("unable to sign with %s: %s (%s)", program, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if stdout.Len() == 0 {
+		return "", fmt.Errorf("unable to sign with %s: empty signature", program)
+	}
+
+	return stdout.String(), nil
+}
+
+// createCommit writes a commit, signed when a signing key is configured
+func (s *state) createCommit(author, committer *git.Signature, message string, tree *git.Tree, parents ...*git.Commit) (*git.Oid, error) {
+	if s.config.SigningKey == "" {
+		return s.repo.CreateCommit("", author, committer, message, tree, parents...)
+	}
+
+	buf, err := s.repo.CreateCommitBuffer(author, committer, git.MessageEncodingUTF8, message, tree, parents...)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := s.sign(string(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.CreateCommitWithSignature(string(buf), signature, "gpgsig")
+}
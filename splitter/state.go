@@ -1,11 +1,16 @@
 package splitter
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	git "github.com/libgit2/git2go/v34"
@@ -19,15 +24,32 @@ type state struct {
 	cache        *cache
 	logger       *log.Logger
 	simplePrefix string
+	filters      map[*Prefix]*treeFilter
+	locations    map[*Prefix]map[string]string
+	ancestors    map[string]bool
+	onto         map[string][]*ontoEntry
+	message      *template.Template
+	mailmap      *mailmap
+	odb          *git.Odb
 	result       *Result
-}
 
-func newState(config *Config, result *Result) (*state, error) {
-	var err error
+	// range of commits to split
+	tip     *git.Oid
+	hide    *git.Oid
+	joins   []*git.Oid
+	commits map[string]bool
+	lastRev *git.Oid
+
+	// commits split since the last checkpoint
+	uncheckpointed int
+	checkpointed   time.Time
+}
 
+// newState returns the state of a split, without writing to the cache when readOnly is true
+func newState(config *Config, result *Result, readOnly bool) (_ *state, err error) {
 	// validate config
 	if err = config.Validate(); err != nil {
-		return nil, err
+		return nil, &ConfigError{Err: err}
 	}
 
 	state := &state{
@@ -38,6 +60,19 @@ func newState(config *Config, result *Result) (*state, error) {
 		logger: config.Logger,
 	}
 
+	// release what was opened here when the state cannot be created
+	defer func() {
+		if err == nil {
+			return
+		}
+		if state.cache != nil && config.DB == nil {
+			state.cache.db.Close()
+		}
+		if state.repo != nil && config.Repo == nil {
+			state.repo.Free()
+		}
+	}()
+
 	if state.repo == nil {
 		if state.repo, err = git.OpenRepository(config.Path); err != nil {
 			return nil, err
@@ -52,13 +87,21 @@ func newState(config *Config, result *Result) (*state, error) {
 		state.logger = log.New(os.Stderr, "", log.LstdFlags)
 	}
 
+	if isPattern(config.Origin) {
+		return nil, fmt.Errorf("the origin %s is a pattern, expand the configuration first", config.Origin)
+	}
+	if prefix := config.globPrefix(); prefix != nil {
+		return nil, fmt.Errorf("the prefix %s is a pattern, expand the configuration first", prefix.From)
+	}
+
 	if state.origin, err = normalizeOrigin(state.repo, config.Origin); err != nil {
 		return nil, err
 	}
 
-	if state.cache, err = newCache(state.origin, config); err != nil {
+	if state.cache, err = newCache(config, readOnly); err != nil {
 		return nil, err
 	}
+	result.setBucket(hex.EncodeToString(state.cache.key))
 
 	if config.Debug {
 		state.logger.Printf("Splitting %s", state.origin)
@@ -68,6 +111,9 @@ func newState(config *Config, result *Result) (*state, error) {
 				to = "ROOT"
 			}
 			state.logger.Printf(`  From "%s" to "%s"`, v.From, to)
+			if (len(v.Includes)) > 0 {
+				state.logger.Printf(`  Including "%s"`, strings.Join(v.Includes, `", "`))
+			}
 			if (len(v.Excludes)) == 0 {
 			} else {
 				state.logger.Printf(`  Excluding "%s"`, strings.Join(v.Excludes, `", "`))
@@ -75,15 +121,31 @@ func newState(config *Config, result *Result) (*state, error) {
 		}
 	}
 
+	if config.MessageTemplate != "" {
+		if state.message, err = newMessageTemplate(config.MessageTemplate); err != nil {
+			return nil, err
+		}
+	}
+
 	if config.Scratch {
 		if err := state.flush(); err != nil {
 			return nil, err
 		}
 	}
 
+	state.checkpointed = time.Now()
+	state.locations = make(map[*Prefix]map[string]string)
+	state.ancestors = make(map[string]bool)
+	state.filters = make(map[*Prefix]*treeFilter)
+	for _, prefix := range config.Prefixes {
+		if filter := newTreeFilter(prefix); filter != nil {
+			state.filters[prefix] = filter
+		}
+	}
+
 	// simplePrefix contains the prefix when there is only one
 	// with an empty value (target)
-	if len(config.Prefixes) == 1 && config.Prefixes[0].To == "" && len(config.Prefixes[0].Excludes) == 0 {
+	if len(config.Prefixes) == 1 && config.Prefixes[0].To == "" && len(config.Prefixes[0].Excludes) == 0 && len(config.Prefixes[0].Includes) == 0 && !config.Prefixes[0].moves() {
 		state.simplePrefix = config.Prefixes[0].From
 	}
 
@@ -95,6 +157,9 @@ func (s *state) close() error {
 	if err != nil {
 		return err
 	}
+	if s.odb != nil {
+		s.odb.Free()
+	}
 	s.repo.Free()
 	return nil
 }
@@ -112,40 +177,83 @@ func (s *state) flush() error {
 		}
 	}
 
+	return deleteKeepRefs(s.repo, hex.EncodeToString(s.cache.key))
+}
+
+func (s *state) split(ctx context.Context) error {
+	return splitAll(ctx, []*state{s})
+}
+
+// CanceledError is returned when a split is canceled
+type CanceledError struct {
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("split canceled: %s", e.Err)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// canceled returns a *CanceledError when the context is done
+func canceled(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return &CanceledError{Err: err}
+	}
 	return nil
 }
 
-func (s *state) split() error {
+// splitAll splits several states sharing the same repository
+// in one traversal of the history
+func splitAll(ctx context.Context, states []*state) error {
 	startTime := time.Now()
 	defer func() {
-		s.result.end(startTime)
+		for _, s := range states {
+			s.result.end(startTime)
+		}
 	}()
 
-	revWalk, err := s.walker()
+	revWalk, err := walker(ctx, states)
 	if err != nil {
-		return fmt.Errorf("impossible to walk the repository: %s", err)
+		return fmt.Errorf("impossible to walk the repository: %w", err)
 	}
 	defer revWalk.Free()
 
 	var iterationErr error
-	var lastRev *git.Oid
 	err = revWalk.Iterate(func(rev *git.Commit) bool {
 		defer rev.Free()
-		lastRev = rev.Id()
 
-		if s.config.Debug {
-			s.logger.Printf("Processing commit: %s\n", rev.Id().String())
-		}
-
-		var newrev *git.Oid
-		newrev, err = s.splitRev(rev)
-		if err != nil {
+		if err := canceled(ctx); err != nil {
 			iterationErr = err
 			return false
 		}
 
-		if newrev != nil {
-			s.result.moveHead(newrev)
+		for _, s := range states {
+			if s.commits != nil && !s.commits[string(rev.Id()[0:20])] {
+				continue
+			}
+			s.lastRev = rev.Id()
+
+			if s.config.Debug {
+				s.logger.Printf("Processing commit: %s\n", rev.Id().String())
+			}
+
+			newrev, err := s.splitRev(rev)
+			if err != nil {
+				iterationErr = err
+				return false
+			}
+
+			if newrev != nil {
+				s.result.moveHead(newrev)
+			}
+
+			if err := s.checkpoint(); err != nil {
+				iterationErr = fmt.Errorf("impossible to checkpoint the cache: %s", err)
+				return false
+			}
 		}
 
 		return true
@@ -153,26 +261,151 @@ func (s *state) split() error {
 	if err != nil {
 		return err
 	}
+
+	// the mappings of interrupted splits are kept as well
+	for _, s := range states {
+		if err := s.flushMappings(); err != nil && iterationErr == nil {
+			iterationErr = err
+		}
+	}
+
 	if iterationErr != nil {
+		var canceled *CanceledError
+		if errors.As(iterationErr, &canceled) {
+			// all the ancestors of the last commits have been split
+			for _, s := range states {
+				if s.lastRev != nil {
+					s.cache.setHead(s.origin, s.lastRev)
+				}
+			}
+		}
 		return iterationErr
 	}
 
-	if lastRev != nil {
-		s.cache.setHead(lastRev)
+	for _, s := range states {
+		if err := s.rejoin(); err != nil {
+			return fmt.Errorf("impossible to rejoin the split: %s", err)
+		}
+
+		if s.lastRev != nil {
+			s.cache.setHead(s.origin, s.lastRev)
+		}
+
+		if err := s.updateTarget(); err != nil {
+			return err
+		}
+
+		if err := s.updateKeepRef(); err != nil {
+			return err
+		}
+
+		if err := s.splitTags(ctx); err != nil {
+			return err
+		}
+
+		if err := s.push(ctx); err != nil {
+			return err
+		}
 	}
 
-	return s.updateTarget()
+	return nil
 }
 
-func (s *state) walker() (*git.RevWalk, error) {
-	revWalk, err := s.repo.Walk()
-	if err != nil {
-		return nil, fmt.Errorf("impossible to walk the repository: %s", err)
+// prepare sets the range to split and reads everything the split commits depend on
+func (s *state) prepare(ctx context.Context) error {
+	if err := s.pushRevs(); err != nil {
+		return fmt.Errorf("impossible to determine split range: %w", err)
+	}
+
+	if s.config.Onto != "" {
+		if err := s.readOnto(ctx); err != nil {
+			return fmt.Errorf("impossible to read the existing history %s: %w", s.config.Onto, err)
+		}
 	}
 
-	err = s.pushRevs(revWalk)
+	if s.config.Mailmap || s.config.MailmapFile != "" {
+		if err := s.readMailmap(); err != nil {
+			return fmt.Errorf("impossible to read the mailmap: %w", err)
+		}
+	}
+
+	if s.config.ReadJoins {
+		if err := s.readJoins(ctx); err != nil {
+			return fmt.Errorf("impossible to read git subtree joins: %w", err)
+		}
+	}
+
+	for _, prefix := range s.config.Prefixes {
+		if prefix.FollowRenames {
+			if err := s.followRenames(ctx, prefix); err != nil {
+				return fmt.Errorf("impossible to follow renames of %s: %w", prefix.From, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// walker returns a walker on the union of the states ranges
+// states with a different range only see their own commits
+func walker(ctx context.Context, states []*state) (*git.RevWalk, error) {
+	repo := states[0].repo
+	for _, s := range states {
+		if err := s.prepare(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	revWalk, err := repo.Walk()
 	if err != nil {
-		return nil, fmt.Errorf("impossible to determine split range: %s", err)
+		return nil, err
+	}
+
+	sameRange := true
+	var hides []*git.Oid
+	for _, s := range states {
+		if s.tip.Cmp(states[0].tip) != 0 || !sameOid(s.hide, states[0].hide) || len(s.joins) > 0 {
+			sameRange = false
+		}
+		if s.hide != nil {
+			hides = append(hides, s.hide)
+		}
+
+		if err := revWalk.Push(s.tip); err != nil {
+			revWalk.Free()
+			return nil, err
+		}
+	}
+
+	// only hide commits that are hidden for all states
+	if len(hides) == len(states) {
+		if sameRange || len(hides) == 1 {
+			err = revWalk.Hide(hides[0])
+		} else {
+			var bases []*git.Oid
+			// unrelated histories have no merge base, nothing to hide
+			if bases, err = repo.MergeBasesMany(hides); git.IsErrorCode(err, git.ErrorCodeNotFound) {
+				err = nil
+			}
+			for _, base := range bases {
+				if err = revWalk.Hide(base); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			revWalk.Free()
+			return nil, err
+		}
+	}
+
+	if !sameRange {
+		for _, s := range states {
+			if err := s.rangeCommits(ctx); err != nil {
+				revWalk.Free()
+				return nil, err
+			}
+		}
 	}
 
 	revWalk.Sorting(git.SortTopological | git.SortReverse)
@@ -180,15 +413,47 @@ func (s *state) walker() (*git.RevWalk, error) {
 	return revWalk, nil
 }
 
+// checkpoint persists the cache when enough commits or time have passed
+// so that an interrupted split resumes from there
+func (s *state) checkpoint() error {
+	s.uncheckpointed++
+
+	due := s.config.CheckpointCommits > 0 && s.uncheckpointed >= s.config.CheckpointCommits
+	if s.config.CheckpointInterval > 0 && time.Since(s.checkpointed) >= s.config.CheckpointInterval {
+		due = true
+	}
+	if !due {
+		return nil
+	}
+
+	// all the ancestors of the last commit have been split
+	s.cache.setHead(s.origin, s.lastRev)
+	if err := s.cache.checkpoint(); err != nil {
+		return err
+	}
+
+	if s.config.Debug {
+		s.logger.Printf("Checkpoint at %s\n", s.lastRev)
+	}
+
+	s.uncheckpointed = 0
+	s.checkpointed = time.Now()
+
+	return nil
+}
+
 func (s *state) splitRev(rev *git.Commit) (*git.Oid, error) {
 	s.result.incTraversed()
 
 	v := s.cache.get(rev.Id())
-	if v != nil {
+	if v != nil && s.exists(v) {
 		if s.config.Debug {
 			s.logger.Printf("  prior: %s\n", v.String())
 		}
-		return v, nil
+		return v, s.writeMapping(rev.Id(), v, MappingReused)
+	}
+	if v != nil && s.config.Debug {
+		s.logger.Printf("  prior %s has been pruned, splitting again\n", v.String())
 	}
 
 	var parents []*git.Oid
@@ -205,7 +470,10 @@ func (s *state) splitRev(rev *git.Commit) (*git.Oid, error) {
 		s.logger.Print(debugMsg)
 	}
 
-	newParents := s.cache.gets(parents)
+	newParents, err := s.splitParents(parents)
+	if err != nil {
+		return nil, err
+	}
 
 	if s.config.Debug {
 		debugMsg := "  newparents:"
@@ -239,13 +507,20 @@ func (s *state) splitRev(rev *git.Commit) (*git.Oid, error) {
 		s.logger.Printf("  newrev is: %s\n", newrev)
 	}
 
+	status := MappingSkipped
 	if created {
 		s.result.incCreated()
+		s.cache.setOriginal(newrev, rev.Id())
+		status = MappingCreated
+	} else if !containsOid(newParents, newrev) {
+		// a commit of the existing split history (--onto)
+		s.cache.setOriginal(newrev, rev.Id())
+		status = MappingReused
 	}
 
 	s.cache.set(rev.Id(), newrev)
 
-	return newrev, nil
+	return newrev, s.writeMapping(rev.Id(), newrev, status)
 }
 
 func (s *state) subtreeForCommit(commit *git.Commit) (*git.Tree, error) {
@@ -259,28 +534,88 @@ func (s *state) subtreeForCommit(commit *git.Commit) (*git.Tree, error) {
 		return s.treeByPath(tree, s.simplePrefix)
 	}
 
-	return s.treeByPaths(tree)
+	return s.treeByPaths(tree, commit.Id())
 }
 
 func (s *state) treeByPath(tree *git.Tree, prefix string) (*git.Tree, error) {
-	treeEntry, err := tree.EntryByPath(prefix)
+	splitTree, _, err := s.prefixTree(tree, &Prefix{From: prefix}, nil)
+	return splitTree, err
+}
+
+// prefixTree returns the tree for a prefix and the directory where it must be moved
+func (s *state) prefixTree(tree *git.Tree, prefix *Prefix, commit *git.Oid) (*git.Tree, string, error) {
+	from := prefix.From
+	if commit != nil {
+		from = s.prefixPath(tree, prefix, commit)
+	}
+
+	treeEntry, err := tree.EntryByPath(from)
 	if err != nil {
-		return nil, nil
+		return nil, "", nil
 	}
 
-	if treeEntry.Type != git.ObjectTree {
-		// tree is not a tree (a directory for a gitmodule for instance), skip
-		return nil, nil
+	switch treeEntry.Type {
+	case git.ObjectTree:
+		splitTree, err := s.repo.LookupTree(treeEntry.Id)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if filter := s.filters[prefix]; filter != nil {
+			prunedTree, err := s.filterTree(splitTree, filter)
+			splitTree.Free()
+			if err != nil || prunedTree == nil {
+				return nil, "", err
+			}
+			splitTree = prunedTree
+		}
+
+		return splitTree, prefix.To, nil
+	case git.ObjectBlob:
+		// a single file, To is then the path of the file in the split
+		name, to := path.Base(from), ""
+		if prefix.To != "" {
+			name, to = path.Base(prefix.To), path.Dir(prefix.To)
+			if to == "." {
+				to = ""
+			}
+		}
+
+		splitTree, err := s.fileTree(name, treeEntry)
+		return splitTree, to, err
 	}
 
-	return s.repo.LookupTree(treeEntry.Id)
+	// not a tree nor a file (a gitmodule for instance), skip
+	return nil, "", nil
 }
 
-func (s *state) treeByPaths(tree *git.Tree) (*git.Tree, error) {
+// fileTree returns a tree containing a single file
+func (s *state) fileTree(name string, entry *git.TreeEntry) (*git.Tree, error) {
+	treeBuilder, err := s.repo.TreeBuilder()
+	if err != nil {
+		return nil, err
+	}
+	defer treeBuilder.Free()
+
+	if err := treeBuilder.Insert(name, entry.Id, entry.Filemode); err != nil {
+		return nil, err
+	}
+
+	oid, err := treeBuilder.Write()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.LookupTree(oid)
+}
+
+func (s *state) treeByPaths(tree *git.Tree, commit *git.Oid) (*git.Tree, error) {
 	var currentTree, prefixedTree, mergedTree *git.Tree
+	// where each merged prefix has been moved, to report conflicts
+	merged := make(map[*Prefix]string)
 	for _, prefix := range s.config.Prefixes {
 		// splitting
-		splitTree, err := s.treeByPath(tree, prefix.From)
+		splitTree, to, err := s.prefixTree(tree, prefix, commit)
 		if err != nil {
 			return nil, err
 		}
@@ -288,17 +623,9 @@ func (s *state) treeByPaths(tree *git.Tree) (*git.Tree, error) {
 			continue
 		}
 
-		if len(prefix.Excludes) > 0 {
-			prunedTree, err := s.pruneTree(splitTree, prefix.Excludes)
-			if err != nil {
-				return nil, err
-			}
-			splitTree = prunedTree
-		}
-
 		// adding the prefix
-		if prefix.To != "" {
-			prefixedTree, err = s.addPrefixToTree(splitTree, prefix.To)
+		if to != "" {
+			prefixedTree, err = s.addPrefixToTree(splitTree, to)
 			if err != nil {
 				return nil, err
 			}
@@ -308,39 +635,77 @@ func (s *state) treeByPaths(tree *git.Tree) (*git.Tree, error) {
 
 		// merging with the current tree
 		if currentTree != nil {
-			mergedTree, err = s.mergeTrees(currentTree, prefixedTree)
+			var conflicts []string
+			mergedTree, conflicts, err = s.mergeTrees(currentTree, prefixedTree)
 			currentTree.Free()
 			prefixedTree.Free()
 			if err != nil {
 				return nil, err
 			}
+			if conflicts != nil {
+				return nil, &ConflictError{
+					Paths:  conflicts,
+					First:  conflictingPrefix(s.config.Prefixes, merged, conflicts[0]),
+					Second: prefix,
+					Commit: commit,
+				}
+			}
 		} else {
 			mergedTree = prefixedTree
 		}
 
+		merged[prefix] = to
 		currentTree = mergedTree
 	}
 
 	return currentTree, nil
 }
 
-func (s *state) mergeTrees(t1, t2 *git.Tree) (*git.Tree, error) {
+// mergeTrees merges two trees, resolving conflicts with the configured strategy;
+// the conflicting paths are returned when they cannot be resolved
+func (s *state) mergeTrees(t1, t2 *git.Tree) (*git.Tree, []string, error) {
 	index, err := s.repo.MergeTrees(nil, t1, t2, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer index.Free()
 
 	if index.HasConflicts() {
-		return nil, fmt.Errorf("cannot split as there is a merge conflict between two paths")
+		paths, err := resolveConflicts(index, s.config.Conflict)
+		if err != nil {
+			return nil, nil, err
+		}
+		if index.HasConflicts() {
+			return nil, paths, nil
+		}
+		if s.config.Debug {
+			s.logger.Printf("Resolved conflicts by keeping the %s prefix: %s\n", s.config.Conflict, strings.Join(paths, ", "))
+		}
 	}
 
 	oid, err := index.WriteTreeTo(s.repo)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return s.repo.LookupTree(oid)
+	tree, err := s.repo.LookupTree(oid)
+	return tree, nil, err
+}
+
+// conflictingPrefix returns the merged prefix moved the closest to the path
+func conflictingPrefix(prefixes []*Prefix, merged map[*Prefix]string, p string) *Prefix {
+	var found *Prefix
+	length := -1
+	for _, prefix := range prefixes {
+		to, ok := merged[prefix]
+		if !ok || len(to) <= length {
+			continue
+		}
+		if found == nil || to == "" || p == to || strings.HasPrefix(p, to+"/") {
+			found, length = prefix, len(to)
+		}
+	}
+	return found
 }
 
 func (s *state) addPrefixToTree(tree *git.Tree, prefix string) (*git.Tree, error) {
@@ -372,51 +737,126 @@ func (s *state) addPrefixToTree(tree *git.Tree, prefix string) (*git.Tree, error
 	return prefixedTree, nil
 }
 
-func (s *state) pruneTree(tree *git.Tree, excludes []string) (*git.Tree, error) {
-	var err error
-	treeBuilder, err := s.repo.TreeBuilder()
-	if err != nil {
-		return nil, err
+// treeFilter removes entries from a prefix tree
+type treeFilter struct {
+	excludes *matcher
+	includes *matcher
+	// pruned trees by path and original tree id (nil for empty trees)
+	pruned map[string]*git.Oid
+}
+
+func newTreeFilter(prefix *Prefix) *treeFilter {
+	if len(prefix.Excludes) == 0 && len(prefix.Includes) == 0 {
+		return nil
 	}
-	defer treeBuilder.Free()
 
-	err = tree.Walk(func(path string, entry *git.TreeEntry) error {
-		// always add files at the root directory
-		if entry.Type == git.ObjectBlob {
-			if err := treeBuilder.Insert(entry.Name, entry.Id, entry.Filemode); err != nil {
-				return err
-			}
-			return nil
-		}
+	filter := &treeFilter{
+		pruned: make(map[string]*git.Oid),
+	}
+	if len(prefix.Excludes) > 0 {
+		filter.excludes = newMatcher(prefix.Excludes, false)
+	}
+	if len(prefix.Includes) > 0 {
+		filter.includes = newMatcher(prefix.Includes, true)
+	}
 
-		if entry.Type != git.ObjectTree {
-			// should never happen
-			return fmt.Errorf("Unexpected entry %s/%s (type %s)", path, entry.Name, entry.Type)
-		}
+	return filter
+}
 
-		// exclude directory in excludes
-		for _, exclude := range excludes {
-			if entry.Name == exclude {
-				return git.TreeWalkSkip
-			}
+// included returns whether a path is kept, inside telling if its parent directory is included
+func (f *treeFilter) included(p string, inside bool) bool {
+	included := inside
+	if f.includes != nil {
+		if matched, positive := f.includes.match(p); matched {
+			included = positive
 		}
+	}
 
-		if err := treeBuilder.Insert(entry.Name, entry.Id, git.FilemodeTree); err != nil {
-			return err
+	if included && f.excludes != nil {
+		if _, excluded := f.excludes.match(p); excluded {
+			return false
 		}
-		return git.TreeWalkSkip
-	})
+	}
+
+	return included
+}
+
+// mayFilterBelow returns true if entries inside a directory might be filtered differently than the directory
+func (f *treeFilter) mayFilterBelow(dir string, included bool) bool {
+	if f.includes != nil && f.includes.mayMatchBelow(dir) {
+		return true
+	}
+
+	return included && f.excludes != nil && f.excludes.mayMatchBelow(dir)
+}
 
+// filterTree applies the includes and excludes of a prefix, returns nil when nothing is left
+func (s *state) filterTree(tree *git.Tree, filter *treeFilter) (*git.Tree, error) {
+	oid, err := s.pruneTree(tree, filter, "", filter.includes == nil)
 	if err != nil {
 		return nil, err
 	}
 
-	treeOid, err := treeBuilder.Write()
+	if oid == nil {
+		// everything was removed, like a missing prefix
+		return nil, nil
+	}
+
+	return s.repo.LookupTree(oid)
+}
+
+// pruneTree only keeps included and not excluded entries at any depth, returns nil when the tree ends up empty
+func (s *state) pruneTree(tree *git.Tree, filter *treeFilter, dir string, inside bool) (*git.Oid, error) {
+	key := fmt.Sprintf("%s\x00%t\x00%s", dir, inside, tree.Id()[0:20])
+	if oid, ok := filter.pruned[key]; ok {
+		return oid, nil
+	}
+
+	treeBuilder, err := s.repo.TreeBuilder()
 	if err != nil {
 		return nil, err
 	}
+	defer treeBuilder.Free()
+
+	entries := 0
+	for i := uint64(0); i < tree.EntryCount(); i++ {
+		entry := tree.EntryByIndex(i)
+		entryPath := path.Join(dir, entry.Name)
+		included := filter.included(entryPath, inside)
 
-	return s.repo.LookupTree(treeOid)
+		id := entry.Id
+		if entry.Type == git.ObjectTree && filter.mayFilterBelow(entryPath, included) {
+			subtree, err := s.repo.LookupTree(entry.Id)
+			if err != nil {
+				return nil, err
+			}
+			id, err = s.pruneTree(subtree, filter, entryPath, included)
+			subtree.Free()
+			if err != nil {
+				return nil, err
+			}
+			if id == nil {
+				continue
+			}
+		} else if !included {
+			continue
+		}
+
+		if err := treeBuilder.Insert(entry.Name, id, entry.Filemode); err != nil {
+			return nil, err
+		}
+		entries++
+	}
+
+	var oid *git.Oid
+	if entries > 0 {
+		if oid, err = treeBuilder.Write(); err != nil {
+			return nil, err
+		}
+	}
+	filter.pruned[key] = oid
+
+	return oid, nil
 }
 
 func (s *state) copyOrSkip(rev *git.Commit, tree *git.Tree, newParents []*git.Oid) (*git.Oid, bool, error) {
@@ -491,6 +931,14 @@ func (s *state) copyOrSkip(rev *git.Commit, tree *git.Tree, newParents []*git.Oi
 		return identical, false, nil
 	}
 
+	// continue the existing split history if any
+	if onto := s.ontoCommit(tree.Id(), gotParents); onto != nil {
+		if s.config.Debug {
+			s.logger.Printf("  reusing %s from the existing history\n", onto)
+		}
+		return onto, false, nil
+	}
+
 	commit, err := s.copyCommit(rev, tree, p)
 	if err != nil {
 		return nil, false, err
@@ -529,17 +977,17 @@ func (s *state) copyCommit(rev *git.Commit, tree *git.Tree, parents []*git.Commi
 		message = s.legacyMessage(rev)
 	}
 
-	author := rev.Author()
-	if author.Email == "" {
-		author.Email = "nobody@example.com"
+	if s.message != nil {
+		var err error
+		if message, err = s.rewriteMessage(rev, message); err != nil {
+			return nil, fmt.Errorf("unable to rewrite the message of %s: %s", rev.Id(), err)
+		}
 	}
 
-	committer := rev.Committer()
-	if committer.Email == "" {
-		committer.Email = "nobody@example.com"
-	}
+	author := s.rewriteIdentity(rev.Author())
+	committer := s.rewriteCommitter(rev.Committer())
 
-	oid, err := s.repo.CreateCommit("", author, committer, message, tree, parents...)
+	oid, err := s.createCommit(author, committer, message, tree, parents...)
 	if err != nil {
 		return nil, err
 	}
@@ -566,8 +1014,10 @@ func (s *state) updateTarget() error {
 			return err
 		}
 		ref.Free()
+		s.result.setTarget(s.config.Target, nil)
 	} else {
 		defer ref.Free()
+		s.result.setTarget(ref.Name(), ref.Target())
 		ref.SetTarget(s.result.Head(), "subtree split")
 	}
 
@@ -580,33 +1030,132 @@ func (s *state) legacyMessage(rev *git.Commit) string {
 }
 
 // pushRevs sets the range to split
-func (s *state) pushRevs(revWalk *git.RevWalk) error {
+func (s *state) pushRevs() error {
 	s.repoMu.Lock()
 	defer s.repoMu.Unlock()
 
+	obj, err := s.repo.RevparseSingle(s.origin)
+	if err != nil {
+		return err
+	}
+	defer obj.Free()
+
+	tip, err := obj.Peel(git.ObjectCommit)
+	if err != nil {
+		return err
+	}
+	defer tip.Free()
+	s.tip = tip.Id()
+
 	var start *git.Oid
-	start = s.cache.getHead()
+	start = s.cache.getHead(s.origin)
+	if start != nil && !s.isAncestor(start, s.tip.String()) {
+		// the origin history has been rewritten since the last split
+		if s.config.OnRewrite == "fail" {
+			return &RewrittenError{Origin: s.origin, Head: start}
+		}
+		if s.config.Debug {
+			s.logger.Printf("The cached head %s is not an ancestor of %s anymore, splitting the whole history\n", start, s.origin)
+		}
+		start = nil
+	}
+	if start != nil {
+		if head := s.cache.get(start); head != nil && !s.exists(head) {
+			if s.config.Debug {
+				s.logger.Printf("The cached split head %s has been pruned, splitting the whole history\n", head)
+			}
+			start = nil
+		}
+	}
 	if start != nil {
 		s.result.moveHead(s.cache.get(start))
-		// FIXME: CHECK that this is an ancestor of the branch?
-		return revWalk.PushRange(fmt.Sprintf("%s..%s", start, s.origin))
+		s.hide = start
+		return nil
 	}
 
 	// find the latest split sha1 if any on origin
-	var err error
 	if s.config.Commit != "" {
 		start, err = git.NewOid(s.config.Commit)
 		if err != nil {
 			return err
 		}
 		s.result.moveHead(s.cache.get(start))
-		return revWalk.PushRange(fmt.Sprintf("%s^..%s", start, s.origin))
+
+		commit, err := s.repo.LookupCommit(start)
+		if err != nil {
+			return err
+		}
+		defer commit.Free()
+		if commit.ParentCount() > 0 {
+			s.hide = commit.ParentId(0)
+		}
 	}
 
-	branch, err := s.repo.RevparseSingle(s.origin)
+	return nil
+}
+
+// RewrittenError is returned when the origin history has been rewritten
+// since the last split (and the rewrite policy is "fail")
+type RewrittenError struct {
+	Origin string
+	// Head is the last split commit of the origin, not an ancestor anymore
+	Head *git.Oid
+}
+
+func (e *RewrittenError) Error() string {
+	return fmt.Sprintf("the history of %s has been rewritten since the last split (%s is not an ancestor anymore), use --scratch or --on-rewrite=walk", e.Origin, e.Head)
+}
+
+// rangeCommits stores the commits of the state range
+func (s *state) rangeCommits(ctx context.Context) error {
+	revWalk, err := s.repo.Walk()
 	if err != nil {
 		return err
 	}
+	defer revWalk.Free()
+
+	if err := revWalk.Push(s.tip); err != nil {
+		return err
+	}
+	if s.hide != nil {
+		if err := revWalk.Hide(s.hide); err != nil {
+			return err
+		}
+	}
+	for _, join := range s.joins {
+		if err := revWalk.Hide(join); err != nil {
+			return err
+		}
+	}
 
-	return revWalk.Push(branch.Id())
+	s.commits = make(map[string]bool)
+	oid := new(git.Oid)
+	for {
+		if err := canceled(ctx); err != nil {
+			return err
+		}
+		if err := revWalk.Next(oid); err != nil {
+			if git.IsErrorCode(err, git.ErrorCodeIterOver) {
+				return nil
+			}
+			return err
+		}
+		s.commits[string(oid[0:20])] = true
+	}
+}
+
+func containsOid(oids []*git.Oid, oid *git.Oid) bool {
+	for _, o := range oids {
+		if o.Cmp(oid) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func sameOid(a, b *git.Oid) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
 }
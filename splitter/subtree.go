@@ -0,0 +1,183 @@
+package splitter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// join represents the git-subtree trailers of a commit
+type join struct {
+	dir      string
+	mainline string
+	split    string
+}
+
+// parseJoin returns the git-subtree trailers of a commit message if any
+func parseJoin(message string) *join {
+	j := &join{}
+	for _, line := range strings.Split(message, "\n") {
+		if v := strings.TrimPrefix(line, "git-subtree-dir: "); v != line {
+			j.dir = strings.TrimRight(strings.TrimSpace(v), "/")
+		} else if v := strings.TrimPrefix(line, "git-subtree-mainline: "); v != line {
+			j.mainline = strings.TrimSpace(v)
+		} else if v := strings.TrimPrefix(line, "git-subtree-split: "); v != line {
+			j.split = strings.TrimSpace(v)
+		}
+	}
+	if j.dir == "" || j.split == "" {
+		return nil
+	}
+	return j
+}
+
+// readJoins bootstraps the cache with the splits recorded by git subtree
+//
+// Split commits are mapped to themselves, mainline commits to their split,
+// and both are excluded from the commits to split.
+func (s *state) readJoins(ctx context.Context) error {
+	revWalk, err := s.repo.Walk()
+	if err != nil {
+		return err
+	}
+	defer revWalk.Free()
+
+	if err := revWalk.Push(s.tip); err != nil {
+		return err
+	}
+	if s.hide != nil {
+		if err := revWalk.Hide(s.hide); err != nil {
+			return err
+		}
+	}
+
+	dir := s.config.Prefixes[0].From
+	var iterationErr error
+	err = revWalk.Iterate(func(commit *git.Commit) bool {
+		defer commit.Free()
+
+		if err := canceled(ctx); err != nil {
+			iterationErr = err
+			return false
+		}
+
+		j := parseJoin(commit.Message())
+		if j == nil || j.dir != dir {
+			return true
+		}
+
+		split, err := git.NewOid(j.split)
+		if err != nil {
+			return true
+		}
+		splitCommit, err := s.repo.LookupCommit(split)
+		if err != nil {
+			if s.config.Debug {
+				s.logger.Printf("Ignoring the join %s as the split commit %s does not exist\n", commit.Id(), split)
+			}
+			return true
+		}
+		splitCommit.Free()
+
+		if s.config.Debug {
+			s.logger.Printf("Found a join in %s for split %s\n", commit.Id(), split)
+		}
+
+		s.cache.set(split, split)
+		s.joins = append(s.joins, split)
+
+		if j.mainline != "" {
+			mainline, err := git.NewOid(j.mainline)
+			if err != nil {
+				iterationErr = fmt.Errorf("invalid mainline in %s: %s", commit.Id(), err)
+				return false
+			}
+			s.cache.set(mainline, split)
+			s.joins = append(s.joins, mainline)
+		}
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	return iterationErr
+}
+
+// rejoin merges the split back into the origin branch the way git subtree does
+func (s *state) rejoin() error {
+	head := s.result.Head()
+	if !s.config.Rejoin || head == nil || s.lastRev == nil {
+		return nil
+	}
+
+	ref, err := s.repo.References.Lookup(s.origin)
+	if err != nil {
+		return err
+	}
+	defer ref.Free()
+
+	branch, err := ref.Resolve()
+	if err != nil {
+		return err
+	}
+	defer branch.Free()
+
+	if !branch.IsBranch() {
+		return fmt.Errorf("cannot rejoin %s as it is not a branch", s.origin)
+	}
+	if branch.Target().Cmp(s.tip) != 0 {
+		return fmt.Errorf("cannot rejoin %s as it has been updated during the split", branch.Name())
+	}
+
+	tip, err := s.repo.LookupCommit(s.tip)
+	if err != nil {
+		return err
+	}
+	defer tip.Free()
+
+	tree, err := tip.Tree()
+	if err != nil {
+		return err
+	}
+	defer tree.Free()
+
+	split, err := s.repo.LookupCommit(head)
+	if err != nil {
+		return err
+	}
+	defer split.Free()
+
+	sig, err := s.repo.DefaultSignature()
+	if err != nil {
+		return fmt.Errorf("cannot rejoin without a Git identity: %s", err)
+	}
+
+	dir := s.config.Prefixes[0].From
+	message := fmt.Sprintf("Split '%s/' into commit '%s'\n\ngit-subtree-dir: %s\ngit-subtree-mainline: %s\ngit-subtree-split: %s\n", dir, head, dir, s.tip, head)
+
+	oid, err := s.createCommit(sig, sig, message, tree, tip, split)
+	if err != nil {
+		return err
+	}
+
+	updated, err := branch.SetTarget(oid, "subtree rejoin")
+	if err != nil {
+		return err
+	}
+	updated.Free()
+
+	if s.config.Debug {
+		s.logger.Printf("Rejoined %s into %s (%s)\n", head, branch.Name(), oid)
+	}
+
+	// the rejoin commit splits to the split head
+	s.cache.set(oid, head)
+	s.lastRev = oid
+	s.result.setRejoined(oid)
+
+	return nil
+}
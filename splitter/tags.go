@@ -0,0 +1,146 @@
+package splitter
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// splitTags creates split tags for all origin tags matching the pattern
+func (s *state) splitTags(ctx context.Context) error {
+	if s.config.Tags == "" {
+		return nil
+	}
+
+	names, err := s.repo.Tags.List()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := canceled(ctx); err != nil {
+			return err
+		}
+
+		if ok, _ := path.Match(s.config.Tags, name); !ok {
+			continue
+		}
+
+		if err := s.splitTag(name); err != nil {
+			return fmt.Errorf("unable to split tag %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *state) splitTag(name string) error {
+	ref, err := s.repo.References.Lookup("refs/tags/" + name)
+	if err != nil {
+		return err
+	}
+	defer ref.Free()
+
+	commit, err := ref.Peel(git.ObjectCommit)
+	if err != nil {
+		// tag on something else than a commit
+		return nil
+	}
+	defer commit.Free()
+
+	newrev := s.cache.get(commit.Id())
+	if newrev == nil {
+		if s.config.Debug {
+			s.logger.Printf("Skipping tag %s as its commit is not part of the split\n", name)
+		}
+		return nil
+	}
+
+	target := strings.Replace(s.config.TagTarget, "{tag}", patternName(s.config.Tags, name), -1)
+	if upToDate(s.repo, target, newrev) {
+		if s.config.Debug {
+			s.logger.Printf("Skipping tag %s as %s is up to date\n", name, target)
+		}
+		return nil
+	}
+
+	oid := newrev
+
+	// annotated tags are recreated with the same tagger and message
+	if tag, err := s.repo.LookupTag(ref.Target()); err == nil {
+		defer tag.Free()
+		if oid, err = s.createTag(target, newrev, tag.Tagger(), tag.Message()); err != nil {
+			return err
+		}
+	}
+
+	if s.config.Debug {
+		s.logger.Printf("Tagging %s as %s (%s)\n", name, target, newrev)
+	}
+
+	newRef, err := s.repo.References.Create(target, oid, true, "subtree split")
+	if err != nil {
+		return err
+	}
+	newRef.Free()
+
+	s.result.addTag(target)
+
+	return nil
+}
+
+// upToDate returns true when the reference exists and points to the commit
+func upToDate(repo *git.Repository, name string, commit *git.Oid) bool {
+	ref, err := repo.References.Lookup(name)
+	if err != nil {
+		return false
+	}
+	defer ref.Free()
+
+	obj, err := ref.Peel(git.ObjectCommit)
+	if err != nil {
+		return false
+	}
+	defer obj.Free()
+
+	return obj.Id().Equal(commit)
+}
+
+// createTag writes an annotated tag object
+func (s *state) createTag(target string, commit *git.Oid, tagger *git.Signature, message string) (*git.Oid, error) {
+	name := strings.TrimPrefix(target, "refs/tags/")
+	name = strings.TrimPrefix(name, "refs/")
+
+	buf := fmt.Sprintf("object %s\ntype commit\ntag %s\n", commit, name)
+	if tagger != nil {
+		buf += fmt.Sprintf("tagger %s\n", formatSignature(tagger))
+	}
+	buf += "\n" + message
+
+	if s.config.SigningKey != "" {
+		if !strings.HasSuffix(buf, "\n") {
+			buf += "\n"
+		}
+		signature, err := s.sign(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf += signature
+	}
+
+	odb, err := s.repo.Odb()
+	if err != nil {
+		return nil, err
+	}
+	defer odb.Free()
+
+	return odb.Write([]byte(buf), git.ObjectTag)
+}
+
+// formatSignature formats a signature the way Git stores it in objects
+func formatSignature(sig *git.Signature) string {
+	return fmt.Sprintf("%s <%s> %d %s", sig.Name, sig.Email, sig.When.Unix(), sig.When.Format("-0700"))
+}
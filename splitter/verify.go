@@ -0,0 +1,203 @@
+package splitter
+
+import (
+	"context"
+	"fmt"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// Mismatch is a cached mapping inconsistent with the repository
+type Mismatch struct {
+	Original *git.Oid
+	Split    *git.Oid
+	Reason   string
+	// Repaired is the split commit after the repair (nil when not repaired)
+	Repaired *git.Oid
+}
+
+// VerifyResult represents the outcome of a cache verification
+type VerifyResult struct {
+	Checked    int
+	Mismatches []*Mismatch
+}
+
+// Verify checks the cached mappings of the origin history for a configuration
+//
+// Each mapped split commit must exist, have the tree of the original commit
+// prefixes, and have the split parents of the original commit as parents.
+// When repair is true, mismatching mappings, and the ones depending on them,
+// are split again.
+func Verify(config *Config, repair bool) (*VerifyResult, error) {
+	c := *config
+	c.Scratch = false
+
+	state, err := newState(&c, &Result{}, !repair)
+	if err != nil {
+		return nil, err
+	}
+	defer state.close()
+
+	return state.verify(repair)
+}
+
+func (s *state) verify(repair bool) (*VerifyResult, error) {
+	if err := s.prepare(context.Background()); err != nil {
+		return nil, err
+	}
+
+	revWalk, err := s.repo.Walk()
+	if err != nil {
+		return nil, err
+	}
+	defer revWalk.Free()
+
+	if err := revWalk.Push(s.tip); err != nil {
+		return nil, err
+	}
+	revWalk.Sorting(git.SortTopological | git.SortReverse)
+
+	verified := &VerifyResult{}
+	repaired := make(map[string]bool)
+	var iterationErr error
+	err = revWalk.Iterate(func(rev *git.Commit) bool {
+		defer rev.Free()
+
+		split := s.cache.get(rev.Id())
+		if split == nil {
+			return true
+		}
+		verified.Checked++
+
+		reason, err := s.verifyMapping(rev, split)
+		if err != nil {
+			iterationErr = err
+			return false
+		}
+
+		dependsOnRepaired := false
+		for n := uint(0); n < rev.ParentCount(); n++ {
+			if repaired[string(rev.ParentId(n)[0:20])] {
+				dependsOnRepaired = true
+			}
+		}
+
+		if reason == "" && !dependsOnRepaired {
+			return true
+		}
+
+		var mismatch *Mismatch
+		if reason != "" {
+			mismatch = &Mismatch{Original: rev.Id(), Split: split, Reason: reason}
+			verified.Mismatches = append(verified.Mismatches, mismatch)
+			if s.config.Debug {
+				s.logger.Printf("Mapping %s -> %s: %s\n", rev.Id(), split, reason)
+			}
+		}
+
+		if !repair {
+			return true
+		}
+
+		if err := s.cache.delete(rev.Id()); err != nil {
+			iterationErr = err
+			return false
+		}
+		newrev, err := s.splitRev(rev)
+		if err != nil {
+			iterationErr = err
+			return false
+		}
+		if mismatch != nil {
+			mismatch.Repaired = newrev
+		}
+		if !sameOid(newrev, split) {
+			repaired[string(rev.Id()[0:20])] = true
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if iterationErr != nil {
+		return nil, iterationErr
+	}
+
+	if repair && len(verified.Mismatches) > 0 {
+		if head := s.cache.getHead(s.origin); head != nil {
+			s.result.moveHead(s.cache.get(head))
+		}
+		if err := s.updateTarget(); err != nil {
+			return nil, err
+		}
+		if err := s.updateKeepRef(); err != nil {
+			return nil, err
+		}
+	}
+
+	return verified, nil
+}
+
+// verifyMapping returns why a mapping is inconsistent (empty when it is not)
+func (s *state) verifyMapping(rev *git.Commit, split *git.Oid) (string, error) {
+	if !s.exists(split) {
+		return "the split commit does not exist", nil
+	}
+
+	tree, err := s.subtreeForCommit(rev)
+	if err != nil {
+		return "", err
+	}
+	if tree == nil {
+		// not split from the prefixes (like commits mapped from git subtree joins)
+		return "", nil
+	}
+	defer tree.Free()
+
+	commit, err := s.repo.LookupCommit(split)
+	if err != nil {
+		return "", err
+	}
+	defer commit.Free()
+
+	if commit.TreeId().Cmp(tree.Id()) != 0 {
+		return fmt.Sprintf("the split tree is %s instead of %s", commit.TreeId(), tree.Id()), nil
+	}
+
+	var parents []*git.Oid
+	for n := uint(0); n < rev.ParentCount(); n++ {
+		parents = append(parents, rev.ParentId(n))
+	}
+	newParents := s.cache.gets(parents)
+
+	// the start of the split
+	if len(newParents) == 0 {
+		return "", nil
+	}
+
+	expected := make(map[string]bool)
+	for _, parent := range newParents {
+		if parent.Cmp(split) == 0 {
+			// the split commit of a parent has been reused
+			return "", nil
+		}
+		expected[string(parent[0:20])] = true
+	}
+
+	actual := make(map[string]bool)
+	for n := uint(0); n < commit.ParentCount(); n++ {
+		actual[string(commit.ParentId(n)[0:20])] = true
+	}
+
+	if len(actual) != len(expected) {
+		return "the split parents do not match the original parents", nil
+	}
+	for parent := range actual {
+		if !expected[parent] {
+			return "the split parents do not match the original parents", nil
+		}
+	}
+
+	return "", nil
+}
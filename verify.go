@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/splitsh/lite/splitter"
+)
+
+// verifyCommand checks the cache of the split described by the flags and returns the exit code
+func verifyCommand(args []string) int {
+	repair := flag.Bool("repair", false, "Split the inconsistent mappings again (optional)")
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 1
+	}
+
+	config, err := newConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	code := 0
+	for _, c := range expand(config) {
+		name := expandedName("", config, c)
+		if name != "" {
+			name += ": "
+		}
+
+		result, err := splitter.Verify(c, *repair)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+
+		for _, mismatch := range result.Mismatches {
+			line := fmt.Sprintf("%s%s -> %s: %s", name, mismatch.Original, mismatch.Split, mismatch.Reason)
+			if mismatch.Repaired != nil {
+				line += fmt.Sprintf(" (repaired as %s)", mismatch.Repaired)
+			}
+			fmt.Println(line)
+		}
+
+		fmt.Fprintf(os.Stderr, "%s%d mappings checked, %d mismatches\n", name, result.Checked, len(result.Mismatches))
+		if len(result.Mismatches) > 0 && !*repair {
+			code = 1
+		}
+	}
+
+	return code
+}